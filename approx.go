@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// textAlphabet returns the distinct bytes of the indexed text other than the
+// '$' record separator, in byte order. These are the bases a mismatch may
+// substitute for a query base.
+func (idx *Index) textAlphabet() []byte {
+	var bytes []byte
+	if idx.fm != nil {
+		bytes = slices.Clone(idx.fm.alphabet)
+	} else {
+		bytes = slices.Clone(idx.text.alphabet())
+	}
+	return slices.DeleteFunc(bytes, func(b byte) bool { return b == '$' })
+}
+
+// extend narrows the rows [lo, hi), whose suffixes share a prefix of length
+// depth, by one more query base c. The suffix array extends the match forward,
+// keeping the rows whose suffix continues with c; the FM-index extends it
+// backward, prepending c. Callers therefore feed the query left to right to the
+// suffix array and right to left to the FM-index (see queryOffset).
+func (idx *Index) extend(lo, hi, depth int, c byte) (int, int) {
+	if idx.fm != nil {
+		code := idx.fm.codes[c]
+		if code == 0 {
+			return 0, 0
+		}
+		return idx.fm.backward(code, lo, hi)
+	}
+	// Suffixes ending before depth sort first, so treat their next byte as -1.
+	next := func(i int) int {
+		if pos := idx.SA.At(i) + depth; pos < idx.text.Len() {
+			return int(idx.text.At(pos))
+		}
+		return -1
+	}
+	start := lo + sort.Search(hi-lo, func(i int) bool { return next(lo+i) >= int(c) })
+	end := start + sort.Search(hi-start, func(i int) bool { return next(start+i) > int(c) })
+	return start, end
+}
+
+// queryOffset returns the query offset consumed at the given depth of an
+// extend walk over a query of length n.
+func (idx *Index) queryOffset(depth, n int) int {
+	if idx.fm != nil {
+		return n - 1 - depth
+	}
+	return depth
+}
+
+// approxHit is an occurrence of a query with substitutions. Mismatches holds
+// the offsets, from the start of the hit, of the substituted bases in
+// ascending order, and Matched the text the query matched.
+type approxHit struct {
+	SuffixEntry
+	Mismatches []int
+	Matched    string
+}
+
+// searchHamming finds every occurrence of query with at most k substitutions.
+// Distinct intervals of hammingIntervals are disjoint, so every occurrence is
+// reported once, with its fewest mismatches.
+func searchHamming(idx *Index, query string, k int) []approxHit {
+	var hits []approxHit
+	hammingIntervals(idx, query, k, func(lo, hi int, mismatches []int, matched string) bool {
+		for i := lo; i < hi; i++ {
+			hits = append(hits, approxHit{idx.Entry(i), mismatches, matched})
+		}
+		return true
+	})
+	return hits
+}
+
+// hammingIntervals backtracks over suffix array intervals: each branch extends
+// its interval by one text base, spending one mismatch when the base does not
+// match the query (degenerate IUPAC codes match every base they stand for),
+// and is pruned once its interval is empty or k is exceeded. visit receives
+// the rows [lo, hi) of every branch that consumes the whole query, with the
+// ascending query offsets of its mismatches (nil for exact matches) and the
+// text matched; the walk stops early once visit returns false.
+func hammingIntervals(idx *Index, query string, k int, visit func(lo, hi int, mismatches []int, matched string) bool) {
+	alphabet := idx.textAlphabet()
+	var mismatches []int
+	path := make([]byte, len(query)) // the text walked, in query order
+	var walk func(lo, hi, depth int) bool
+	walk = func(lo, hi, depth int) bool {
+		if depth == len(query) {
+			var found []int
+			if len(mismatches) > 0 {
+				found = slices.Sorted(slices.Values(mismatches))
+			}
+			return visit(lo, hi, found, string(path))
+		}
+		j := idx.queryOffset(depth, len(query))
+		for _, c := range alphabet {
+			match := baseMatches(query[j], c)
+			if !match && len(mismatches) == k {
+				continue
+			}
+			nlo, nhi := idx.extend(lo, hi, depth, c)
+			if nlo >= nhi {
+				continue
+			}
+			path[j] = c
+			if !match {
+				mismatches = append(mismatches, j)
+			}
+			more := walk(nlo, nhi, depth+1)
+			if !match {
+				mismatches = mismatches[:len(mismatches)-1]
+			}
+			if !more {
+				return false
+			}
+		}
+		return true
+	}
+	walk(0, idx.Len(), 0)
+}
+
+// editHit is an occurrence of a query within an edit distance. It spans the
+// text [Pos, End) and aligns to the query as described by CIGAR, where M is a
+// match or substitution, I a query base missing from the text and D a text
+// base missing from the query. Matched is the text [Pos, End).
+type editHit struct {
+	SuffixEntry
+	End      int
+	Distance int
+	CIGAR    string
+	Matched  string
+}
+
+// searchEdit finds every occurrence of query within Levenshtein distance k. It
+// walks suffix array intervals like searchHamming, carrying one column of the
+// dynamic programming table per text base: row j holds the distance between
+// query[:j] and the text walked so far. A branch is pruned once every row
+// exceeds k, and every text it walks with the full query within k is a
+// candidate hit. The suffix array walks candidates from their start and the
+// FM-index from their end, but both see the same candidates, which are then
+// aligned alike by alignEdit: without a leading or trailing indel, as a hit
+// shifted by one base is the same occurrence. Only the best hit per start is
+// reported, the lowest distance, then the shortest span.
+func searchEdit(idx *Index, query string, k int) []editHit {
+	alphabet := idx.textAlphabet()
+	m := len(query)
+	// q is the query in the order the walk consumes it.
+	q := []byte(query)
+	if idx.fm != nil {
+		slices.Reverse(q)
+	}
+	first := make([]int, m+1)
+	for j := range first {
+		first[j] = j
+	}
+	table := [][]int{first}
+	var path []byte
+	best := make(map[int]editHit)
+
+	accept := func(lo, hi int) {
+		matched := slices.Clone(path)
+		if idx.fm != nil {
+			slices.Reverse(matched)
+		}
+		dist, cigar, ok := alignEdit(query, string(matched))
+		if !ok || dist > k {
+			return
+		}
+		for i := lo; i < hi; i++ {
+			entry := idx.Entry(i)
+			hit := editHit{entry, entry.Pos + len(matched), dist, cigar, string(matched)}
+			if prev, ok := best[entry.Pos]; !ok || hit.Distance < prev.Distance ||
+				hit.Distance == prev.Distance && hit.End < prev.End {
+				best[entry.Pos] = hit
+			}
+		}
+	}
+
+	var walk func(lo, hi int)
+	walk = func(lo, hi int) {
+		depth := len(path)
+		prev := table[depth]
+		if depth > 0 && prev[m] <= k {
+			accept(lo, hi)
+		}
+		if depth == m+k {
+			return
+		}
+		for _, c := range alphabet {
+			nlo, nhi := idx.extend(lo, hi, depth, c)
+			if nlo >= nhi {
+				continue
+			}
+			col := make([]int, m+1)
+			col[0] = depth + 1
+			lowest := col[0]
+			for j := 1; j <= m; j++ {
+				col[j] = min(prev[j-1]+editCost(c, q[j-1]), prev[j]+1, col[j-1]+1)
+				lowest = min(lowest, col[j])
+			}
+			if lowest > k {
+				continue
+			}
+			table = append(table, col)
+			path = append(path, c)
+			walk(nlo, nhi)
+			table = table[:len(table)-1]
+			path = path[:len(path)-1]
+		}
+	}
+	walk(0, idx.Len())
+
+	hits := make([]editHit, 0, len(best))
+	for _, hit := range best {
+		hits = append(hits, hit)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Pos != hits[j].Pos {
+			return hits[i].Pos < hits[j].Pos
+		}
+		return hits[i].End < hits[j].End
+	})
+	return hits
+}
+
+// alignEdit aligns query to text with the fewest edits such that both ends are
+// M columns, the first bases and the last bases of query and text aligned to
+// each other. It returns the distance and CIGAR of the alignment, or ok false
+// if there is none, when exactly one of query and text is a single base.
+func alignEdit(query, text string) (dist int, cigar string, ok bool) {
+	m, n := len(query), len(text)
+	if m == 1 || n == 1 {
+		if m != n {
+			return 0, "", false
+		}
+		return editCost(text[0], query[0]), "1M", true
+	}
+	// Align the inner bases; table[i][j] is the distance between text[1:i+1]
+	// and query[1:j+1].
+	q, t := query[1:m-1], text[1:n-1]
+	table := make([][]int, len(t)+1)
+	for i := range table {
+		table[i] = make([]int, len(q)+1)
+		table[i][0] = i
+	}
+	for j := range table[0] {
+		table[0][j] = j
+	}
+	for i := 1; i <= len(t); i++ {
+		for j := 1; j <= len(q); j++ {
+			table[i][j] = min(table[i-1][j-1]+editCost(t[i-1], q[j-1]), table[i][j-1]+1, table[i-1][j]+1)
+		}
+	}
+	ops := []byte{'M'}
+	for i, j := len(t), len(q); i > 0 || j > 0; {
+		switch {
+		case i > 0 && j > 0 && table[i][j] == table[i-1][j-1]+editCost(t[i-1], q[j-1]):
+			ops = append(ops, 'M')
+			i, j = i-1, j-1
+		case j > 0 && table[i][j] == table[i][j-1]+1:
+			ops = append(ops, 'I')
+			j--
+		default:
+			ops = append(ops, 'D')
+			i--
+		}
+	}
+	ops = append(ops, 'M')
+	slices.Reverse(ops)
+	dist = editCost(text[0], query[0]) + table[len(t)][len(q)] + editCost(text[n-1], query[m-1])
+	return dist, compactCIGAR(ops), true
+}
+
+// editCost is the cost of aligning text base c to query base b.
+func editCost(c, b byte) int {
+	if baseMatches(b, c) {
+		return 0
+	}
+	return 1
+}
+
+// compactCIGAR run-length encodes alignment operations, "MMMIM" becoming
+// "3M1I1M".
+func compactCIGAR(ops []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(ops); {
+		j := i
+		for j < len(ops) && ops[j] == ops[i] {
+			j++
+		}
+		fmt.Fprintf(&b, "%d%c", j-i, ops[i])
+		i = j
+	}
+	return b.String()
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// bruteHamming returns the start and mismatch offsets of every window of text
+// within k substitutions of query that does not cross a record separator.
+func bruteHamming(text, query string, k int) map[int][]int {
+	hits := make(map[int][]int)
+	for p := 0; p+len(query) <= len(text); p++ {
+		window := text[p : p+len(query)]
+		if strings.Contains(window, "$") {
+			continue
+		}
+		var mismatches []int
+		for j := range query {
+			if !baseMatches(query[j], window[j]) {
+				mismatches = append(mismatches, j)
+			}
+		}
+		if len(mismatches) <= k {
+			hits[p] = mismatches
+		}
+	}
+	return hits
+}
+
+func TestSearchHammingMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	g := randomGenome(rng, 3, 200)
+	indexes := map[string]*Index{
+		backendSA: buildIndex(g, indexOptions{}),
+		backendFM: buildIndex(g, indexOptions{Backend: backendFM, SampleRate: 4}),
+	}
+	for i := 0; i < 100; i++ {
+		start := rng.Intn(len(g.Text) - 10)
+		query := []byte(g.Text[start : start+4+rng.Intn(6)])
+		// Mutate a base so exact matching alone would miss the origin.
+		query[rng.Intn(len(query))] = "ACGT"[rng.Intn(4)]
+		k := rng.Intn(3)
+		expected := bruteHamming(g.Text, string(query), k)
+		for backend, idx := range indexes {
+			got := make(map[int][]int)
+			for _, hit := range searchHamming(idx, string(query), k) {
+				if _, dup := got[hit.Pos]; dup {
+					t.Errorf("%s: query %q reported position %d twice", backend, query, hit.Pos)
+				}
+				if rec := g.recordAt(hit.Pos); hit.Line != rec {
+					t.Errorf("%s: hit at %d in record %d, expected %d", backend, hit.Pos, hit.Line, rec)
+				}
+				got[hit.Pos] = hit.Mismatches
+			}
+			if len(got) != len(expected) {
+				t.Errorf("%s: query %q k=%d found %d hits, expected %d", backend, query, k, len(got), len(expected))
+				continue
+			}
+			for pos, mismatches := range expected {
+				if !reflect.DeepEqual(got[pos], mismatches) {
+					t.Errorf("%s: query %q at %d: mismatches %v, expected %v", backend, query, pos, got[pos], mismatches)
+				}
+			}
+		}
+	}
+}
+
+func TestSearchHammingExactMatchesSearchSequence(t *testing.T) {
+	idx := buildIndex(&Genome{Text: "GATTACA$TTACAGATTACA", Records: []Record{{Start: 0, Len: 7}, {Start: 8, Len: 12}}}, indexOptions{})
+	var got, expected []int
+	for _, hit := range searchHamming(idx, "TTACA", 0) {
+		got = append(got, hit.Pos)
+	}
+	for _, entry := range searchSequence(idx, "TTACA") {
+		expected = append(expected, entry.Pos)
+	}
+	sort.Ints(got)
+	sort.Ints(expected)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("k=0: got %v, expected %v", got, expected)
+	}
+}
+
+// editDistance is the textbook Levenshtein distance.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cur[j] = min(prev[j-1]+editCost(a[i-1], b[j-1]), prev[j]+1, cur[j-1]+1)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestSearchEditAgainstBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	g := randomGenome(rng, 2, 150)
+	indexes := map[string]*Index{
+		backendSA: buildIndex(g, indexOptions{}),
+		backendFM: buildIndex(g, indexOptions{Backend: backendFM, SampleRate: 3}),
+	}
+	for i := 0; i < 60; i++ {
+		start := rng.Intn(len(g.Text) - 12)
+		query := []byte(g.Text[start : start+5+rng.Intn(6)])
+		// Delete one base and substitute another.
+		d := rng.Intn(len(query))
+		query = append(query[:d], query[d+1:]...)
+		query[rng.Intn(len(query))] = "ACGT"[rng.Intn(4)]
+		k := 1 + rng.Intn(2)
+		for backend, idx := range indexes {
+			hits := searchEdit(idx, string(query), k)
+			for _, hit := range hits {
+				window := g.Text[hit.Pos:hit.End]
+				if strings.Contains(window, "$") {
+					t.Fatalf("%s: hit %+v crosses a record boundary", backend, hit)
+				}
+				if dist := editDistance(window, string(query)); dist > hit.Distance || hit.Distance > k {
+					t.Errorf("%s: query %q hit %+v: window %q has distance %d", backend, query, hit, window, dist)
+				}
+				if got := cigarDistance(t, hit.CIGAR, window, string(query)); got != hit.Distance {
+					t.Errorf("%s: query %q hit %+v: CIGAR implies distance %d", backend, query, hit, got)
+				}
+				if !strings.HasSuffix(hit.CIGAR, "M") || hit.CIGAR[strings.IndexAny(hit.CIGAR, "MID")] != 'M' {
+					t.Errorf("%s: query %q hit %+v: CIGAR opens or ends with an indel", backend, query, hit)
+				}
+			}
+			// Every window within k substitutions overlaps a hit at least as good.
+			for p, mismatches := range bruteHamming(g.Text, string(query), k) {
+				found := false
+				for _, hit := range hits {
+					if hit.Pos < p+len(query) && p < hit.End && hit.Distance <= len(mismatches) {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("%s: query %q k=%d: no hit covers window at %d", backend, query, k, p)
+				}
+			}
+		}
+	}
+}
+
+func TestSearchEditSameOnBothBackends(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	g := randomGenome(rng, 3, 300)
+	sa := buildIndex(g, indexOptions{})
+	fm := buildIndex(g, indexOptions{Backend: backendFM, SampleRate: 5})
+	// plain drops the LCP value, which only the suffix array backend has.
+	plain := func(hits []editHit) []editHit {
+		for i := range hits {
+			hits[i].LCP = 0
+		}
+		return hits
+	}
+	queries := []string{"TGTA", "GATTACA", "ACNGT", "CCC"}
+	for i := 0; i < 30; i++ {
+		start := rng.Intn(len(g.Text) - 10)
+		queries = append(queries, g.Text[start:start+3+rng.Intn(7)])
+	}
+	for _, query := range queries {
+		if strings.Contains(query, "$") {
+			continue
+		}
+		for k := 1; k <= 2; k++ {
+			got, expected := plain(searchEdit(fm, query, k)), plain(searchEdit(sa, query, k))
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("query %q k=%d: FM-index hits %+v, suffix array hits %+v", query, k, got, expected)
+			}
+		}
+	}
+}
+
+// cigarDistance replays cigar over text and query and returns the number of
+// edits it implies, failing if it does not consume both exactly.
+func cigarDistance(t *testing.T, cigar, text, query string) int {
+	t.Helper()
+	i, j, dist := 0, 0, 0
+	for len(cigar) > 0 {
+		n := 0
+		for cigar[0] >= '0' && cigar[0] <= '9' {
+			n = n*10 + int(cigar[0]-'0')
+			cigar = cigar[1:]
+		}
+		op := cigar[0]
+		cigar = cigar[1:]
+		for ; n > 0; n-- {
+			switch op {
+			case 'M':
+				dist += editCost(text[i], query[j])
+				i, j = i+1, j+1
+			case 'I':
+				dist, j = dist+1, j+1
+			case 'D':
+				dist, i = dist+1, i+1
+			}
+		}
+	}
+	if i != len(text) || j != len(query) {
+		t.Fatalf("CIGAR consumes %d text and %d query bases of %q and %q", i, j, text, query)
+	}
+	return dist
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// phredOffset is the ASCII offset of Sanger / Illumina 1.8+ quality strings.
+const phredOffset = 33
+
+// qualityFilter trims and drops FASTQ reads by Phred quality. Zero values
+// disable the corresponding step.
+type qualityFilter struct {
+	// TrimQual trims bases from the 3' end while their quality is below it.
+	TrimQual int
+	// MinQual drops reads whose mean quality, after trimming, is below it.
+	MinQual int
+}
+
+// apply trims seq according to qual and reports whether the read should be kept.
+func (qf qualityFilter) apply(seq, qual string) (string, bool) {
+	end := len(seq)
+	if qf.TrimQual > 0 {
+		for end > 0 && int(qual[end-1])-phredOffset < qf.TrimQual {
+			end--
+		}
+	}
+	if end == 0 {
+		return "", false
+	}
+	if qf.MinQual > 0 {
+		sum := 0
+		for i := 0; i < end; i++ {
+			sum += int(qual[i]) - phredOffset
+		}
+		if sum < qf.MinQual*end {
+			return "", false
+		}
+	}
+	return seq[:end], true
+}
+
+// isFASTQ reports whether the first nonempty line of data is a FASTQ header.
+func isFASTQ(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '@'
+}
+
+// parseFASTQ reads four-line FASTQ records, applying qf to each read. The read
+// ID (the first word of the '@' line) becomes the sequence name. Bases are
+// upper-cased like FASTA input.
+func parseFASTQ(data []byte, qf qualityFilter) ([]namedSeq, error) {
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" {
+			lines = append(lines, trimmed)
+		}
+	}
+	if len(lines)%4 != 0 {
+		return nil, fmt.Errorf("fastq: truncated record after %d complete reads", len(lines)/4)
+	}
+	var reads []namedSeq
+	for i := 0; i < len(lines); i += 4 {
+		header, seq, sep, qual := lines[i], lines[i+1], lines[i+2], lines[i+3]
+		if header[0] != '@' {
+			return nil, fmt.Errorf("fastq: record %d: header %q does not start with '@'", i/4+1, header)
+		}
+		if sep[0] != '+' {
+			return nil, fmt.Errorf("fastq: record %d: expected '+' separator line, got %q", i/4+1, sep)
+		}
+		if len(seq) != len(qual) {
+			return nil, fmt.Errorf("fastq: record %d: sequence length %d does not match quality length %d", i/4+1, len(seq), len(qual))
+		}
+		trimmed, ok := qf.apply(strings.ToUpper(seq), qual)
+		if !ok {
+			continue
+		}
+		reads = append(reads, namedSeq{name: headerName(header[1:]), seq: trimmed})
+	}
+	return reads, nil
+}
+
+// parseQueries reads query patterns from FASTA, FASTQ or plain one-per-line
+// data. Plain patterns have no name. Bases are upper-cased like the genome's,
+// and FASTA records without bases are skipped, as an empty pattern would match
+// at every position.
+func parseQueries(data []byte, qf qualityFilter) ([]namedSeq, error) {
+	switch {
+	case isFASTA(data):
+		return slices.DeleteFunc(parseFASTA(data), func(q namedSeq) bool { return q.seq == "" }), nil
+	case isFASTQ(data):
+		return parseFASTQ(data, qf)
+	}
+	var queries []namedSeq
+	for _, l := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(l)
+		if trimmed != "" {
+			queries = append(queries, namedSeq{seq: strings.ToUpper(trimmed)})
+		}
+	}
+	return queries, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFASTQQualityFilter(t *testing.T) {
+	// Quality characters: 'I' = Q40, '5' = Q20, '#' = Q2.
+	data := "@read1 lane 1\nACGTAC\n+\nIIIII#\n" +
+		"@read2\nacgt\n+read2\nIIII\n" +
+		"@read3\nGGGG\n+\n####\n" +
+		"@read4\nTTTT\n+\n55#I\n"
+
+	reads, err := parseFASTQ([]byte(data), qualityFilter{})
+	if err != nil {
+		t.Fatalf("parseFASTQ: %v", err)
+	}
+	if len(reads) != 4 || reads[0].name != "read1" || reads[1].seq != "ACGT" {
+		t.Errorf("Unfiltered reads: got %v", reads)
+	}
+
+	// Trimming at Q10 cuts the trailing '#' of read1 and all of read3; the mean
+	// quality of read4 (20, 20, 2, 40) is 20.5, below a minimum of 25.
+	reads, err = parseFASTQ([]byte(data), qualityFilter{TrimQual: 10, MinQual: 25})
+	if err != nil {
+		t.Fatalf("parseFASTQ: %v", err)
+	}
+	expected := []namedSeq{{name: "read1", seq: "ACGTA"}, {name: "read2", seq: "ACGT"}}
+	if !reflect.DeepEqual(reads, expected) {
+		t.Errorf("Filtered reads: got %v, expected %v", reads, expected)
+	}
+}
+
+func TestParseFASTQErrors(t *testing.T) {
+	testCases := []struct {
+		data string
+		err  string
+	}{
+		{data: "@r1\nACGT\n+\nIIII\n@r2\nACGT\n", err: "truncated"},
+		{data: "@r1\nACGT\n-\nIIII\n", err: "separator"},
+		{data: "@r1\nACGT\n+\nIII\n", err: "does not match"},
+	}
+	for _, tc := range testCases {
+		_, err := parseFASTQ([]byte(tc.data), qualityFilter{})
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("parseFASTQ(%q): got error %v, expected one containing %q", tc.data, err, tc.err)
+		}
+	}
+}
+
+func TestParseQueriesFormats(t *testing.T) {
+	plain, _ := parseQueries([]byte("ACG\n\nTGC\n"), qualityFilter{})
+	fasta, _ := parseQueries([]byte(">p1\nAC\nG\n>p2\nTGC\n"), qualityFilter{})
+	fastq, _ := parseQueries([]byte("@p1\nACG\n+\nIII\n@p2\nTGC\n+\nIII\n"), qualityFilter{})
+	if !reflect.DeepEqual(plain, []namedSeq{{seq: "ACG"}, {seq: "TGC"}}) {
+		t.Errorf("Plain queries: got %v", plain)
+	}
+	named := []namedSeq{{name: "p1", seq: "ACG"}, {name: "p2", seq: "TGC"}}
+	if !reflect.DeepEqual(fasta, named) {
+		t.Errorf("FASTA queries: got %v, expected %v", fasta, named)
+	}
+	if !reflect.DeepEqual(fastq, named) {
+		t.Errorf("FASTQ queries: got %v, expected %v", fastq, named)
+	}
+
+	// Records without bases are no queries.
+	fasta, _ = parseQueries([]byte(">a\n>p1\nACG\n>b\n\n>p2\nTGC\n>c\n"), qualityFilter{})
+	if !reflect.DeepEqual(fasta, named) {
+		t.Errorf("FASTA queries with empty records: got %v, expected %v", fasta, named)
+	}
+}
@@ -2,48 +2,547 @@ package main
 
 import (
 	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/bits"
 	"os"
-	"strconv"
-	"strings"
+	"slices"
 )
 
-// saveIndex writes the suffix entries to a file (one entry per line: pos, line, LCP).
-func saveIndex(filename string, entries []SuffixEntry) error {
-	var lines []string
-	for _, entry := range entries {
-		line := fmt.Sprintf("%d %d %d", entry.Pos, entry.Line, entry.LCP)
-		lines = append(lines, line)
+// Index file layout (all integers little-endian):
+//
+//	header   magic "DNATOOLS", version u32, element width u32, entry count u64,
+//	         section count u32, CRC-32C checksum u32
+//	table    one (id u32, reserved u32, offset u64, length u64) per section
+//	sections 8-byte aligned payloads; integer arrays hold count signed
+//	         elements of the element width (4 or 8 bytes)
+//
+// The checksum covers everything after the header.
+//
+// Version 2 added the genome text, record table and fingerprint sections;
+// version 3 the FM-index backend, whose files hold the FM sections instead of
+// the position, line, LCP and text sections; version 4 replaced the plain text
+// section (4) with the two-bit packed text and its exception runs; version 5
+// dropped the per-entry line section (2), since records are found through the
+// record table; version 6 replaced the exception runs (15) with the lowercase
+// and exception bitmaps, the exception rank and the exception bytes.
+const (
+	indexMagic      = "DNATOOLS"
+	indexVersion    = 6
+	indexHeaderSize = 32
+	indexTableEntry = 24
+)
+
+// Section identifiers.
+const (
+	sectionPos = 1
+	sectionLCP = 3
+	// Record table (see encodeRecords).
+	sectionRecords = 5
+	// SHA-256 fingerprint of the text and record table.
+	sectionFingerprint = 6
+	// FM-index parameters: sample rate and checkpoint rate (u64 each).
+	sectionFMParams = 7
+	// FM-index alphabet, BWT codes, occurrence checkpoints, sampled row bitmap,
+	// its per-word rank and the sampled suffix array values.
+	sectionFMAlphabet   = 8
+	sectionFMBWT        = 9
+	sectionFMOcc        = 10
+	sectionFMMarked     = 11
+	sectionFMMarkedRank = 12
+	sectionFMSamples    = 13
+	// Genome text packed at two bits per base (see packedSeq), its lowercase
+	// and exception bitmaps, the exception rank of every bitmap word and the
+	// exception bytes.
+	sectionPackedText   = 14
+	sectionTextLower    = 16
+	sectionTextExc      = 17
+	sectionTextExcRank  = 18
+	sectionTextExcBytes = 19
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// indexSection is one section to be written: its id, payload size in bytes and
+// a function streaming the payload.
+type indexSection struct {
+	id    uint32
+	size  int64
+	write func(w io.Writer) error
+}
+
+// intSection returns a section holding n integers of the given width produced
+// by at.
+func intSection(id uint32, width, n int, at func(i int) int) indexSection {
+	return indexSection{
+		id:   id,
+		size: int64(n) * int64(width),
+		write: func(w io.Writer) error {
+			var buf [8]byte
+			for i := 0; i < n; i++ {
+				if width == 4 {
+					binary.LittleEndian.PutUint32(buf[:4], uint32(int32(at(i))))
+				} else {
+					binary.LittleEndian.PutUint64(buf[:8], uint64(int64(at(i))))
+				}
+				if _, err := w.Write(buf[:width]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
 	}
-	content := strings.Join(lines, "\n")
-	return os.WriteFile(filename, []byte(content), 0644)
 }
 
-// loadIndex reads the suffix entries from a file.
-func loadIndex(filename string) ([]SuffixEntry, error) {
-	file, err := os.Open(filename)
+// bytesSection returns a section holding b verbatim.
+func bytesSection(id uint32, b []byte) indexSection {
+	return indexSection{
+		id:   id,
+		size: int64(len(b)),
+		write: func(w io.Writer) error {
+			_, err := w.Write(b)
+			return err
+		},
+	}
+}
+
+// elementWidth returns the narrowest supported element width (in bytes) able to
+// hold positions in a text of n characters.
+func elementWidth(n int) int {
+	if n < math.MaxInt32 {
+		return 4
+	}
+	return 8
+}
+
+// writeIndexFile writes a complete index file: header, section table and the
+// aligned section payloads, backfilling the checksum once everything is written.
+func writeIndexFile(filename string, width, count int, sections []indexSection) error {
+	file, err := os.Create(filename)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer file.Close()
-	var entries []SuffixEntry
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Fields(line)
-		if len(parts) != 3 {
-			continue
+
+	table := make([]byte, len(sections)*indexTableEntry)
+	offset := int64(indexHeaderSize + len(table))
+	for i, s := range sections {
+		offset = align8(offset)
+		e := table[i*indexTableEntry:]
+		binary.LittleEndian.PutUint32(e[0:], s.id)
+		binary.LittleEndian.PutUint64(e[8:], uint64(offset))
+		binary.LittleEndian.PutUint64(e[16:], uint64(s.size))
+		offset += s.size
+	}
+
+	// Leave room for the header, then checksum everything that follows it.
+	if _, err := file.Seek(indexHeaderSize, io.SeekStart); err != nil {
+		return err
+	}
+	crc := crc32.New(crcTable)
+	bw := bufio.NewWriter(io.MultiWriter(file, crc))
+	cw := &countingWriter{w: bw, n: indexHeaderSize}
+	if _, err := cw.Write(table); err != nil {
+		return err
+	}
+	for _, s := range sections {
+		if pad := align8(cw.n) - cw.n; pad > 0 {
+			if _, err := cw.Write(make([]byte, pad)); err != nil {
+				return err
+			}
+		}
+		start := cw.n
+		if err := s.write(cw); err != nil {
+			return err
+		}
+		if cw.n-start != s.size {
+			return fmt.Errorf("index: section %d wrote %d bytes, expected %d", s.id, cw.n-start, s.size)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	header := make([]byte, indexHeaderSize)
+	copy(header, indexMagic)
+	binary.LittleEndian.PutUint32(header[8:], indexVersion)
+	binary.LittleEndian.PutUint32(header[12:], uint32(width))
+	binary.LittleEndian.PutUint64(header[16:], uint64(count))
+	binary.LittleEndian.PutUint32(header[24:], uint32(len(sections)))
+	binary.LittleEndian.PutUint32(header[28:], crc.Sum32())
+	if _, err := file.WriteAt(header, 0); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// countingWriter tracks the file offset while streaming sections.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func align8(n int64) int64 {
+	return (n + 7) &^ 7
+}
+
+// indexFile is a validated index file: its header fields and section payloads.
+type indexFile struct {
+	width    int
+	count    int
+	sections map[uint32][]byte
+}
+
+// parseIndexFile validates the header and section table of an index file held
+// in data, and its checksum if verify is set.
+func parseIndexFile(data []byte, verify bool) (*indexFile, error) {
+	if len(data) < indexHeaderSize {
+		return nil, fmt.Errorf("index: truncated header (%d bytes)", len(data))
+	}
+	if string(data[:8]) != indexMagic {
+		return nil, errors.New("index: not a dnatools index (bad magic)")
+	}
+	if v := binary.LittleEndian.Uint32(data[8:]); v != indexVersion {
+		return nil, fmt.Errorf("index: unsupported format version %d (expected %d)", v, indexVersion)
+	}
+	width := int(binary.LittleEndian.Uint32(data[12:]))
+	if width != 4 && width != 8 {
+		return nil, fmt.Errorf("index: invalid element width %d", width)
+	}
+	count := binary.LittleEndian.Uint64(data[16:])
+	numSections := uint64(binary.LittleEndian.Uint32(data[24:]))
+	tableEnd := indexHeaderSize + numSections*indexTableEntry
+	if tableEnd > uint64(len(data)) {
+		return nil, fmt.Errorf("index: truncated section table (%d sections, %d bytes)", numSections, len(data))
+	}
+	if verify {
+		if sum := crc32.Checksum(data[indexHeaderSize:], crcTable); sum != binary.LittleEndian.Uint32(data[28:]) {
+			return nil, fmt.Errorf("index: checksum mismatch (file is corrupt or truncated)")
 		}
-		pos, err1 := strconv.Atoi(parts[0])
-		lineNum, err2 := strconv.Atoi(parts[1])
-		lcpVal, err3 := strconv.Atoi(parts[2])
-		if err1 != nil || err2 != nil || err3 != nil {
-			continue
+	}
+	if count > uint64(len(data)) {
+		return nil, fmt.Errorf("index: entry count %d exceeds file size", count)
+	}
+
+	f := &indexFile{width: width, count: int(count), sections: make(map[uint32][]byte)}
+	for i := uint64(0); i < numSections; i++ {
+		e := data[indexHeaderSize+i*indexTableEntry:]
+		id := binary.LittleEndian.Uint32(e[0:])
+		offset := binary.LittleEndian.Uint64(e[8:])
+		length := binary.LittleEndian.Uint64(e[16:])
+		if offset < tableEnd || offset > uint64(len(data)) || length > uint64(len(data))-offset {
+			return nil, fmt.Errorf("index: section %d out of bounds (offset %d, length %d, file %d bytes)", id, offset, length, len(data))
 		}
-		entries = append(entries, SuffixEntry{Pos: pos, Line: lineNum, LCP: lcpVal})
+		f.sections[id] = data[offset : offset+length]
+	}
+	return f, nil
+}
+
+// ints returns an integer array section viewed in place, checking that it
+// holds exactly n elements.
+func (f *indexFile) ints(id uint32, n int) (intArray, error) {
+	b, ok := f.sections[id]
+	if !ok {
+		return nil, fmt.Errorf("index: missing section %d", id)
+	}
+	if len(b) != n*f.width {
+		return nil, fmt.Errorf("index: section %d holds %d bytes, expected %d", id, len(b), n*f.width)
 	}
-	if err := scanner.Err(); err != nil {
+	if f.width == 4 {
+		return leInt32s(b), nil
+	}
+	return leInt64s(b), nil
+}
+
+// saveIndex writes an index file. Suffix array indexes get separate position
+// and LCP sections followed by the packed genome text; FM-indexes get
+// their FM sections instead. Both store the genome records and fingerprint.
+func saveIndex(filename string, idx *Index) error {
+	n := idx.Len()
+	width := elementWidth(n)
+	var sections []indexSection
+	if fm := idx.fm; fm != nil {
+		var params []byte
+		params = binary.LittleEndian.AppendUint64(params, uint64(fm.sampleRate))
+		params = binary.LittleEndian.AppendUint64(params, fmOccRate)
+		sections = []indexSection{
+			bytesSection(sectionFMParams, params),
+			bytesSection(sectionFMAlphabet, fm.alphabet),
+			bytesSection(sectionFMBWT, fm.bwt),
+			intSection(sectionFMOcc, width, fm.occ.Len(), fm.occ.At),
+			bytesSection(sectionFMMarked, fm.marked),
+			intSection(sectionFMMarkedRank, width, fm.markedRank.Len(), fm.markedRank.At),
+			intSection(sectionFMSamples, width, fm.samples.Len(), fm.samples.At),
+		}
+	} else {
+		sections = []indexSection{
+			intSection(sectionPos, width, n, idx.SA.At),
+			intSection(sectionLCP, width, n, idx.LCP.At),
+			bytesSection(sectionPackedText, idx.text.words),
+			bytesSection(sectionTextLower, idx.text.lower),
+			bytesSection(sectionTextExc, idx.text.exc),
+			intSection(sectionTextExcRank, width, idx.text.excRank.Len(), idx.text.excRank.At),
+			bytesSection(sectionTextExcBytes, idx.text.excBytes),
+		}
+	}
+	sections = append(sections,
+		bytesSection(sectionRecords, encodeRecords(idx.Genome.Records)),
+		bytesSection(sectionFingerprint, idx.Fingerprint[:]),
+	)
+	return writeIndexFile(filename, width, n, sections)
+}
+
+// loadIndex maps an index file and fully verifies it, returning an error if the
+// file is truncated, corrupt or of an unknown version.
+func loadIndex(filename string) (*Index, error) {
+	return openIndex(filename, true)
+}
+
+// openIndex maps an index file read-only so searches run directly over its
+// pages without decoding. The header and section layout are always validated;
+// the checksum, genome fingerprint and suffix positions, which require reading
+// the whole file, only when verify is set; otherwise suffix positions, text
+// exception ranks and FM-index symbols, rows and samples are range-checked as
+// searches read them, reporting corruption through Index.Err.
+func openIndex(filename string, verify bool) (*Index, error) {
+	data, unmap, err := mapFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := decodeIndex(data, verify)
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	idx.unmap = unmap
+	return idx, nil
+}
+
+// decodeIndex validates an index file and wraps its sections. The returned
+// index and genome refer to data rather than copying it.
+func decodeIndex(data []byte, verify bool) (*Index, error) {
+	f, err := parseIndexFile(data, verify)
+	if err != nil {
+		return nil, err
+	}
+	idx := &Index{}
+	if len(f.sections[sectionFingerprint]) != len(idx.Fingerprint) {
+		return nil, errors.New("index: missing genome fingerprint")
+	}
+	copy(idx.Fingerprint[:], f.sections[sectionFingerprint])
+	if _, ok := f.sections[sectionFMParams]; ok {
+		if idx.fm, err = decodeFMIndex(f, verify); err != nil {
+			return nil, err
+		}
+		// The FM-index keeps no text, only the record table.
+		records, err := decodeRecords(f.sections[sectionRecords], f.count-1)
+		if err != nil {
+			return nil, fmt.Errorf("index: %w", err)
+		}
+		idx.Genome = &Genome{Records: records}
+		if !verify {
+			idx.fm.samples = checkedPositions{idx.fm.samples, f.count, &idx.err}
+			idx.fm.err = &idx.err
+		}
+		return idx, nil
+	}
+
+	var cols [2]intArray
+	for i, id := range []uint32{sectionPos, sectionLCP} {
+		if cols[i], err = f.ints(id, f.count); err != nil {
+			return nil, err
+		}
+	}
+	text := &packedSeq{n: f.count - 1, words: f.sections[sectionPackedText]}
+	if len(text.words) != packedWords(text.n)*8 {
+		return nil, fmt.Errorf("index: packed text holds %d bytes, expected %d", len(text.words), packedWords(text.n)*8)
+	}
+	if err := decodeTextMasks(f, text); err != nil {
+		return nil, err
+	}
+	records, err := decodeRecords(f.sections[sectionRecords], text.n)
+	if err != nil {
+		return nil, fmt.Errorf("index: %w", err)
+	}
+	// The plain text is not kept: searches read the packed text in place.
+	idx.Genome = &Genome{Records: records}
+	idx.SA, idx.LCP, idx.text = cols[0], cols[1], text
+	if !verify {
+		idx.SA = checkedPositions{idx.SA, f.count, &idx.err}
+		text.err = &idx.err
+		return idx, nil
+	}
+
+	if rank := bitmapRank(text.exc); !slices.Equal(toInts(rank), toInts(text.excRank)) {
+		return nil, errors.New("index: text exception rank does not match its bitmap")
+	}
+	if (&Genome{Text: text.String(), Records: records}).Fingerprint() != idx.Fingerprint {
+		return nil, errors.New("index: stored genome fingerprint does not match genome text")
+	}
+	for i := 0; i < f.count; i++ {
+		if pos := idx.SA.At(i); pos < 0 || pos >= f.count {
+			return nil, fmt.Errorf("index: suffix position %d out of range at entry %d", pos, i)
+		}
+	}
+	return idx, nil
+}
+
+// decodeTextMasks wraps the lowercase and exception sections of a packed text,
+// checking that the bitmaps cover the text and that the exception rank, as far
+// as it can be checked without reading it all, agrees with the exception bytes.
+func decodeTextMasks(f *indexFile, text *packedSeq) error {
+	size := bitmapBytes(text.n)
+	text.lower, text.exc = f.sections[sectionTextLower], f.sections[sectionTextExc]
+	if len(text.lower) != 0 && len(text.lower) != size {
+		return fmt.Errorf("index: lowercase bitmap holds %d bytes, expected %d", len(text.lower), size)
+	}
+	if len(text.exc) != 0 && len(text.exc) != size {
+		return fmt.Errorf("index: exception bitmap holds %d bytes, expected %d", len(text.exc), size)
+	}
+	var err error
+	if text.excRank, err = f.ints(sectionTextExcRank, len(text.exc)/8); err != nil {
+		return err
+	}
+	text.excBytes = f.sections[sectionTextExcBytes]
+	if w := text.excRank.Len() - 1; w >= 0 {
+		last := text.excRank.At(w) + bits.OnesCount64(binary.LittleEndian.Uint64(text.exc[w*8:]))
+		if text.excRank.At(0) != 0 || last != len(text.excBytes) {
+			return fmt.Errorf("index: exception bitmap counts %d exceptions, %d stored", last, len(text.excBytes))
+		}
+	} else if len(text.excBytes) != 0 {
+		return fmt.Errorf("index: %d exceptions stored without a bitmap", len(text.excBytes))
+	}
+	return nil
+}
+
+// decodeFMIndex wraps the FM-index sections of an index file, checking that
+// their sizes agree with each other and, if verify is set, their contents.
+func decodeFMIndex(f *indexFile, verify bool) (*fmIndex, error) {
+	params := f.sections[sectionFMParams]
+	if len(params) != 16 {
+		return nil, fmt.Errorf("index: FM parameters hold %d bytes, expected 16", len(params))
+	}
+	fm := &fmIndex{
+		n:          f.count,
+		sampleRate: int(binary.LittleEndian.Uint64(params)),
+		alphabet:   f.sections[sectionFMAlphabet],
+		bwt:        f.sections[sectionFMBWT],
+		marked:     f.sections[sectionFMMarked],
+	}
+	if occRate := binary.LittleEndian.Uint64(params[8:]); occRate != fmOccRate {
+		return nil, fmt.Errorf("index: unsupported FM checkpoint rate %d", occRate)
+	}
+	if fm.sampleRate < 1 {
+		return nil, fmt.Errorf("index: invalid FM sample rate %d", fm.sampleRate)
+	}
+	if len(fm.bwt) != fm.n {
+		return nil, fmt.Errorf("index: BWT holds %d bytes, expected %d", len(fm.bwt), fm.n)
+	}
+	words := (fm.n + 63) / 64
+	if len(fm.marked) != words*8 {
+		return nil, fmt.Errorf("index: sampled row bitmap holds %d bytes, expected %d", len(fm.marked), words*8)
+	}
+	if len(fm.alphabet) == 0 || len(fm.alphabet) > 255 {
+		return nil, fmt.Errorf("index: invalid FM alphabet of %d symbols", len(fm.alphabet))
+	}
+	for c, b := range fm.alphabet {
+		if c > 0 && b <= fm.alphabet[c-1] {
+			return nil, errors.New("index: FM alphabet is not sorted")
+		}
+		fm.codes[b] = byte(c + 1)
+	}
+
+	var err error
+	sigma := len(fm.alphabet)
+	if fm.occ, err = f.ints(sectionFMOcc, (fm.n/fmOccRate+1)*sigma); err != nil {
+		return nil, err
+	}
+	if fm.markedRank, err = f.ints(sectionFMMarkedRank, words); err != nil {
+		return nil, err
+	}
+	samples := f.sections[sectionFMSamples]
+	if fm.samples, err = f.ints(sectionFMSamples, len(samples)/f.width); err != nil {
+		return nil, err
+	}
+	if verify {
+		for i, c := range fm.bwt {
+			if int(c) > sigma {
+				return nil, fmt.Errorf("index: invalid BWT symbol %d at row %d", c, i)
+			}
+		}
+		for i := 0; i < fm.samples.Len(); i++ {
+			if pos := fm.samples.At(i); pos < 0 || pos >= fm.n {
+				return nil, fmt.Errorf("index: sampled position %d out of range", pos)
+			}
+		}
+	}
+	// Symbol totals, and so the counts table, follow from the BWT.
+	var freq [256]int
+	for c, b := range fm.alphabet {
+		freq[b] = fm.occAt(byte(c+1), fm.n)
+	}
+	fm.setCounts(freq)
+	return fm, nil
+}
+
+// stdinName is the input file name that stands for standard input.
+const stdinName = "-"
+
+// openInput opens an input file for streaming, transparently decompressing it
+// when it starts with the gzip magic bytes. Multi-member files, including
+// BGZF, are read through to the last member. The name "-" reads standard
+// input. The returned release closes the file; it leaves standard input open.
+func openInput(filename string) (r io.Reader, release func() error, err error) {
+	var file io.Reader = os.Stdin
+	release = func() error { return nil }
+	if filename != stdinName {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		file, release = f, f.Close
+	}
+	if r, err = decompressed(file); err != nil {
+		release()
+		return nil, nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return r, release, nil
+}
+
+// readInput reads a whole input file through openInput.
+func readInput(filename string) ([]byte, error) {
+	r, release, err := openInput(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return io.ReadAll(r)
+}
+
+// decompressed wraps r in a gzip reader if its content is gzip-compressed, so
+// callers can stream compressed and plain input alike.
+func decompressed(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		// Too short to be gzip or not gzip at all: pass through unchanged.
+		return br, nil
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
 		return nil, err
 	}
-	return entries, nil
+	zr.Multistream(true)
+	return zr, nil
 }
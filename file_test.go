@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math/rand"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadInputGzip(t *testing.T) {
+	tempDir := t.TempDir()
+	content := ">chr1\nACGT\n>chr2\nTGCA\n"
+
+	// Write the content as two gzip members, the way BGZF splits its blocks.
+	var buf bytes.Buffer
+	for _, part := range []string{content[:9], content[9:]} {
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(part))
+		zw.Close()
+	}
+	gzFile := tempDir + "/genome.fa.gz"
+	if err := os.WriteFile(gzFile, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write gzip file: %v", err)
+	}
+	plainFile := tempDir + "/genome.fa"
+	if err := os.WriteFile(plainFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write plain file: %v", err)
+	}
+
+	for _, name := range []string{gzFile, plainFile} {
+		data, err := readInput(name)
+		if err != nil {
+			t.Fatalf("readInput(%s): %v", name, err)
+		}
+		if string(data) != content {
+			t.Errorf("readInput(%s): got %q, expected %q", name, data, content)
+		}
+	}
+
+	// A file with the gzip magic but a corrupt body must fail, not pass through.
+	badFile := tempDir + "/bad.gz"
+	if err := os.WriteFile(badFile, buf.Bytes()[:20], 0644); err != nil {
+		t.Fatalf("Failed to write truncated file: %v", err)
+	}
+	if _, err := readInput(badFile); err == nil {
+		t.Errorf("Expected an error reading a truncated gzip file")
+	}
+}
+
+func TestLoadIndexRejectsCorruption(t *testing.T) {
+	tempDir := t.TempDir()
+	indexFile := tempDir + "/sa.idx"
+	g, _ := parseGenome([]byte("ACGT\nTGCA\n"), qualityFilter{})
+	if err := saveIndex(indexFile, buildIndex(g, indexOptions{})); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+
+	corrupt := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), data...))
+	}
+	testCases := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{name: "empty", data: nil, err: "truncated header"},
+		{name: "bad magic", data: corrupt(func(b []byte) []byte { b[0] = 'X'; return b }), err: "bad magic"},
+		{name: "version", data: corrupt(func(b []byte) []byte { b[8] = 99; return b }), err: "unsupported format version"},
+		{name: "truncated", data: data[:len(data)-4], err: "checksum mismatch"},
+		{name: "flipped byte", data: corrupt(func(b []byte) []byte { b[len(b)-1] ^= 0xff; return b }), err: "checksum mismatch"},
+	}
+	for _, tc := range testCases {
+		name := tempDir + "/corrupt.idx"
+		if err := os.WriteFile(name, tc.data, 0644); err != nil {
+			t.Fatalf("Failed to write index: %v", err)
+		}
+		_, err := loadIndex(name)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got error %v, expected one containing %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestIndexGenomeFingerprint(t *testing.T) {
+	tempDir := t.TempDir()
+	indexFile := tempDir + "/sa.idx"
+	g, _ := parseGenome([]byte(">chr1\nACGT\n>chr2\nTGCA\n"), qualityFilter{})
+	if err := saveIndex(indexFile, buildIndex(g, indexOptions{})); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+	idx, err := loadIndex(indexFile)
+	if err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	if idx.text.String() != g.Text || !reflect.DeepEqual(idx.Genome.Records, g.Records) {
+		t.Errorf("Stored genome differs: got %q %+v, expected %q %+v", idx.text.String(), idx.Genome.Records, g.Text, g.Records)
+	}
+	if err := idx.checkGenome(g); err != nil {
+		t.Errorf("checkGenome on the indexed genome: %v", err)
+	}
+
+	// Same text under different record names must not match either.
+	changed := []string{">chr1\nACGT\n>chr2\nTGCC\n", ">chrA\nACGT\n>chr2\nTGCA\n"}
+	for _, data := range changed {
+		other, _ := parseGenome([]byte(data), qualityFilter{})
+		if err := idx.checkGenome(other); err == nil || !strings.Contains(err.Error(), "does not match index") {
+			t.Errorf("checkGenome(%q): got %v, expected a mismatch error", data, err)
+		}
+	}
+}
+
+func TestOpenIndexMapped(t *testing.T) {
+	tempDir := t.TempDir()
+	indexFile := tempDir + "/sa.idx"
+	g, _ := parseGenome([]byte("banana\n"), qualityFilter{})
+	if err := saveIndex(indexFile, buildIndex(g, indexOptions{})); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+
+	idx, err := openIndex(indexFile, false)
+	if err != nil {
+		t.Fatalf("openIndex: %v", err)
+	}
+	results := searchSequence(idx, "ANA")
+	if len(results) != 2 || results[0].Pos != 3 || results[1].Pos != 1 {
+		t.Errorf("Search over the mapped index: got %v, expected positions 3 and 1", results)
+	}
+	if err := idx.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+
+	// Damage the stored fingerprint at the end of the file: structure is
+	// intact, so only a verifying open notices.
+	data, _ := os.ReadFile(indexFile)
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(indexFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+	if idx, err := openIndex(indexFile, false); err != nil {
+		t.Errorf("openIndex without verification: %v", err)
+	} else {
+		idx.Close()
+	}
+	if _, err := openIndex(indexFile, true); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("openIndex with verification: got %v, expected a checksum mismatch", err)
+	}
+}
+
+func TestOpenIndexReportsBadPositions(t *testing.T) {
+	tempDir := t.TempDir()
+	indexFile := tempDir + "/sa.idx"
+	g, _ := parseGenome([]byte("banana\n"), qualityFilter{})
+	if err := saveIndex(indexFile, buildIndex(g, indexOptions{})); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+
+	// Overwrite the suffix positions with values past the text, leaving the
+	// structure intact so an unverified open succeeds.
+	data, _ := os.ReadFile(indexFile)
+	f, err := parseIndexFile(data, false)
+	if err != nil {
+		t.Fatalf("parseIndexFile: %v", err)
+	}
+	for i := range f.sections[sectionPos] {
+		f.sections[sectionPos][i] = 0x7f
+	}
+	if err := os.WriteFile(indexFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+	idx, err := openIndex(indexFile, false)
+	if err != nil {
+		t.Fatalf("openIndex without verification: %v", err)
+	}
+	defer idx.Close()
+	searchSequence(idx, "ANA")
+	if err := idx.Err(); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("Search over corrupt positions: got %v, expected an out of range error", err)
+	}
+}
+
+// TestUnverifiedCorruptionDoesNotCrash flips random bytes of suffix array and
+// FM-index files and searches them unverified: each run must either fail to
+// open, report the corruption through Index.Err or return some results, but
+// never panic.
+func TestUnverifiedCorruptionDoesNotCrash(t *testing.T) {
+	rng := rand.New(rand.NewSource(10))
+	g := randomGenome(rng, 3, 300)
+	g.Text = strings.Replace(g.Text, "A", "n", 20)
+	tempDir := t.TempDir()
+	m, _ := parseMotif("CA.{1,3}G")
+	for _, backend := range []string{backendSA, backendFM} {
+		indexFile := tempDir + "/" + backend + ".idx"
+		if err := saveIndex(indexFile, buildIndex(g, indexOptions{Backend: backend, SampleRate: 4})); err != nil {
+			t.Fatalf("Failed to save index: %v", err)
+		}
+		data, _ := os.ReadFile(indexFile)
+		for run := 0; run < 300; run++ {
+			corrupted := slices.Clone(data)
+			for i := 0; i < 3; i++ {
+				corrupted[rng.Intn(len(corrupted))] = byte(rng.Intn(256))
+			}
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("%s run %d: search panicked: %v", backend, run, r)
+					}
+				}()
+				idx, err := decodeIndex(corrupted, false)
+				if err != nil {
+					return
+				}
+				for i := 0; i < idx.Len(); i++ {
+					idx.Entry(i)
+				}
+				searchSequence(idx, "ACG")
+				searchHamming(idx, "CATTG", 1)
+				searchEdit(idx, "GATC", 1)
+				searchMotif(idx, m, strandBoth)
+			}()
+		}
+	}
+}
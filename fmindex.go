@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// fmOccRate is the spacing, in BWT rows, of the occurrence checkpoints.
+const fmOccRate = 64
+
+// defaultSampleRate keeps the suffix array value of every 32nd text position.
+const defaultSampleRate = 32
+
+// fmIndex is an FM-index over the genome: the Burrows–Wheeler transform with
+// occurrence checkpoints for rank queries, and a suffix array sampled by text
+// position for locating hits. Its rows are the rows of the suffix array.
+type fmIndex struct {
+	n        int
+	bwt      []byte    // BWT as symbol codes; 0 is the end-of-text sentinel
+	alphabet []byte    // alphabet[c-1] is the text byte with code c
+	codes    [256]byte // text byte to code, 0 if absent from the text
+	counts   []int     // counts[c] is the number of rows starting below code c
+	occ      intArray  // occ[b*sigma+c-1] counts code c in bwt[:b*fmOccRate]
+
+	sampleRate int
+	marked     []byte   // bit i (little-endian 64-bit words) set for sampled rows
+	markedRank intArray // set bits in the marked words before each word
+	samples    intArray // suffix array values of the sampled rows, in row order
+
+	// err, set for FM-indexes read from an unverified index, receives the
+	// first BWT symbol, row or sample found out of range (see
+	// checkedPositions).
+	err *error
+}
+
+// buildFMIndex derives the FM-index of text from its suffix array (including
+// the sentinel suffix), sampling every sampleRate-th text position.
+func buildFMIndex(text byteSeq, sa intArray, sampleRate int) *fmIndex {
+	fm := &fmIndex{n: sa.Len(), sampleRate: sampleRate}
+	var freq [256]int
+	for i := 0; i < text.Len(); i++ {
+		freq[text.At(i)]++
+	}
+	for b := 0; b < 256; b++ {
+		if freq[b] > 0 {
+			fm.alphabet = append(fm.alphabet, byte(b))
+			fm.codes[b] = byte(len(fm.alphabet))
+		}
+	}
+	sigma := len(fm.alphabet)
+	fm.setCounts(freq)
+
+	fm.bwt = make([]byte, fm.n)
+	for i := 0; i < fm.n; i++ {
+		if pos := sa.At(i); pos > 0 {
+			fm.bwt[i] = fm.codes[text.At(pos-1)]
+		}
+	}
+
+	occ := make(intSlice, (fm.n/fmOccRate+1)*sigma)
+	running := make([]int, sigma+1)
+	for i := 0; i <= fm.n; i++ {
+		if i%fmOccRate == 0 {
+			copy(occ[(i/fmOccRate)*sigma:], running[1:])
+		}
+		if i < fm.n {
+			running[fm.bwt[i]]++
+		}
+	}
+	fm.occ = occ
+
+	words := (fm.n + 63) / 64
+	fm.marked = make([]byte, words*8)
+	markedRank := make(intSlice, words)
+	var samples intSlice
+	for i := 0; i < fm.n; i++ {
+		if pos := sa.At(i); pos%sampleRate == 0 {
+			w := i / 64
+			binary.LittleEndian.PutUint64(fm.marked[w*8:], binary.LittleEndian.Uint64(fm.marked[w*8:])|1<<(i%64))
+			samples = append(samples, pos)
+		}
+	}
+	for w := 1; w < words; w++ {
+		markedRank[w] = markedRank[w-1] + bits.OnesCount64(binary.LittleEndian.Uint64(fm.marked[(w-1)*8:]))
+	}
+	fm.markedRank = markedRank
+	fm.samples = samples
+	return fm
+}
+
+// setCounts fills counts from the frequency of every text byte; the sentinel
+// occupies row 0.
+func (fm *fmIndex) setCounts(freq [256]int) {
+	fm.counts = make([]int, len(fm.alphabet)+2)
+	fm.counts[1] = 1
+	for c, b := range fm.alphabet {
+		fm.counts[c+2] = fm.counts[c+1] + freq[b]
+	}
+}
+
+// occAt returns the number of occurrences of code c in bwt[:i].
+func (fm *fmIndex) occAt(c byte, i int) int {
+	block := i / fmOccRate
+	count := fm.occ.At(block*len(fm.alphabet) + int(c) - 1)
+	for j := block * fmOccRate; j < i; j++ {
+		if fm.bwt[j] == c {
+			count++
+		}
+	}
+	return count
+}
+
+// lf maps row i to the row of the suffix starting one position earlier.
+func (fm *fmIndex) lf(i int) int {
+	c := fm.bwt[i]
+	if fm.err != nil && (c == 0 || int(c) > len(fm.alphabet)) {
+		corrupt(fm.err, "BWT symbol %d out of range at row %d", c, i)
+		return 0
+	}
+	row := fm.counts[c] + fm.occAt(c, i)
+	if fm.err != nil && (row < 0 || row >= fm.n) {
+		corrupt(fm.err, "FM-index row %d out of range", row)
+		return 0
+	}
+	return row
+}
+
+// backward narrows the rows [lo, hi) to those whose suffixes, preceded by the
+// symbol with code c, start one position earlier.
+func (fm *fmIndex) backward(c byte, lo, hi int) (int, int) {
+	lo, hi = fm.counts[c]+fm.occAt(c, lo), fm.counts[c]+fm.occAt(c, hi)
+	if fm.err != nil && (lo < 0 || hi > fm.n || lo > hi) {
+		corrupt(fm.err, "FM-index rows [%d, %d) out of range", lo, hi)
+		return 0, 0
+	}
+	return lo, hi
+}
+
+// interval returns the rows [lo, hi) of suffixes prefixed by query, found by
+// backward search.
+func (fm *fmIndex) interval(query string) (lo, hi int) {
+	lo, hi = 0, fm.n
+	for j := len(query) - 1; j >= 0 && lo < hi; j-- {
+		c := fm.codes[query[j]]
+		if c == 0 {
+			return 0, 0
+		}
+		lo, hi = fm.backward(c, lo, hi)
+	}
+	return lo, hi
+}
+
+// locate returns the text position of row i, walking LF until a sampled row is
+// reached. Since every sampleRate-th position is sampled, at most sampleRate-1
+// steps are taken.
+func (fm *fmIndex) locate(i int) int {
+	steps := 0
+	for {
+		w, bit := i/64, uint(i%64)
+		word := binary.LittleEndian.Uint64(fm.marked[w*8:])
+		if word&(1<<bit) != 0 {
+			rank := fm.markedRank.At(w) + bits.OnesCount64(word&(1<<bit-1))
+			if fm.err != nil && (rank < 0 || rank >= fm.samples.Len()) {
+				corrupt(fm.err, "sample %d out of range at row %d", rank, i)
+				return 0
+			}
+			return fm.samples.At(rank) + steps
+		}
+		if fm.err != nil && steps == fm.sampleRate {
+			corrupt(fm.err, "no sampled row within %d steps of row %d", steps, i)
+			return 0
+		}
+		i = fm.lf(i)
+		steps++
+	}
+}
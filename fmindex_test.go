@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// randomGenome returns a genome of several records of random bases.
+func randomGenome(rng *rand.Rand, records, length int) *Genome {
+	var data strings.Builder
+	for r := 0; r < records; r++ {
+		data.WriteString(">rec" + string(rune('A'+r)) + "\n")
+		for i := 0; i < length; i++ {
+			data.WriteByte("ACGTN"[rng.Intn(5)])
+		}
+		data.WriteByte('\n')
+	}
+	g, _ := parseGenome([]byte(data.String()), qualityFilter{})
+	return g
+}
+
+func TestFMIndexMatchesSuffixArray(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	g := randomGenome(rng, 3, 300)
+	saIdx := buildIndex(g, indexOptions{})
+
+	tempDir := t.TempDir()
+	if err := saveIndex(tempDir+"/fm.idx", buildIndex(g, indexOptions{Backend: backendFM})); err != nil {
+		t.Fatalf("Failed to save FM index: %v", err)
+	}
+	fmIdx, err := loadIndex(tempDir + "/fm.idx")
+	if err != nil {
+		t.Fatalf("Failed to load FM index: %v", err)
+	}
+	defer fmIdx.Close()
+	if fmIdx.fm == nil || fmIdx.Genome.Text != "" {
+		t.Fatalf("Expected an FM-index without genome text")
+	}
+
+	// Queries taken from the genome, plus some that cannot occur.
+	queries := []string{"X", "ACGTACGTACGTACGT", "A$C"}
+	for i := 0; i < 200; i++ {
+		start := rng.Intn(len(g.Text) - 8)
+		queries = append(queries, g.Text[start:start+1+rng.Intn(8)])
+	}
+	for _, q := range queries {
+		expected := searchSequence(saIdx, q)
+		got := searchSequence(fmIdx, q)
+		for i := range expected {
+			expected[i].LCP = 0 // the FM-index has no LCP values
+		}
+		sort.Slice(expected, func(i, j int) bool { return expected[i].Pos < expected[j].Pos })
+		sort.Slice(got, func(i, j int) bool { return got[i].Pos < got[j].Pos })
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Query %q: FM-index found %v, suffix array %v", q, got, expected)
+		}
+	}
+}
+
+func TestFMIndexSampleRates(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	g := randomGenome(rng, 2, 250)
+	saIdx := buildIndex(g, indexOptions{})
+	for _, rate := range []int{1, 2, 7, 32, 1000} {
+		idx := buildIndex(g, indexOptions{Backend: backendFM, SampleRate: rate})
+		if got, want := idx.fm.samples.Len(), (len(g.Text)+1+rate-1)/rate; got != want {
+			t.Errorf("Sample rate %d: kept %d values, expected %d", rate, got, want)
+		}
+		// Every row must locate to the suffix array value.
+		for i := 0; i < saIdx.Len(); i++ {
+			if got, want := idx.fm.locate(i), saIdx.SA.At(i); got != want {
+				t.Fatalf("Sample rate %d: locate(%d) got %d, expected %d", rate, i, got, want)
+			}
+		}
+	}
+}
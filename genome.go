@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// Record describes one sequence of the genome: its name and where it lives in
+// the concatenated text. Records read from plain line-per-sequence files have
+// no name and are identified by their index.
+type Record struct {
+	Name  string
+	Start int
+	Len   int
+}
+
+// Genome is the concatenation of all input sequences, separated by '$', along
+// with the records that make it up. Records, sorted by Start, doubles as the
+// boundary table mapping text positions to records (see recordAt).
+type Genome struct {
+	Text    string
+	Records []Record
+}
+
+// parseGenome builds a genome from the contents of a sequence file. Files whose
+// first nonempty line starts with '>' are read as (multi-)FASTA and files
+// starting with '@' as FASTQ, with every read kept by qf becoming a record;
+// anything else is treated as one sequence per nonempty line. Bases are
+// upper-cased in every format, as are queries (see parseQueries).
+func parseGenome(data []byte, qf qualityFilter) (*Genome, error) {
+	switch {
+	case isFASTA(data):
+		return buildGenome(parseFASTA(data)), nil
+	case isFASTQ(data):
+		reads, err := parseFASTQ(data, qf)
+		if err != nil {
+			return nil, err
+		}
+		return buildGenome(reads), nil
+	}
+	var records []namedSeq
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" {
+			records = append(records, namedSeq{seq: strings.ToUpper(trimmed)})
+		}
+	}
+	return buildGenome(records), nil
+}
+
+// namedSeq is a parsed sequence before it is placed in the genome text.
+type namedSeq struct {
+	name string
+	seq  string
+}
+
+// buildGenome concatenates the sequences, recording where each one starts.
+func buildGenome(seqs []namedSeq) *Genome {
+	g := &Genome{Records: make([]Record, 0, len(seqs))}
+	var genomeBuilder strings.Builder
+	for i, s := range seqs {
+		g.Records = append(g.Records, Record{Name: s.name, Start: genomeBuilder.Len(), Len: len(s.seq)})
+		genomeBuilder.WriteString(s.seq)
+		// Append a separator if not the last sequence.
+		if i < len(seqs)-1 {
+			genomeBuilder.WriteByte('$')
+		}
+	}
+	g.Text = genomeBuilder.String()
+	return g
+}
+
+// isFASTA reports whether the first nonempty line of data is a FASTA header.
+func isFASTA(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '>'
+}
+
+// parseFASTA splits (multi-)FASTA data into records. Wrapped sequence lines are
+// joined, the record name is the first word of the header, ';' comment lines
+// are skipped and bases are upper-cased so soft-masked regions still match.
+func parseFASTA(data []byte) []namedSeq {
+	var records []namedSeq
+	var name string
+	var seq strings.Builder
+	inRecord := false
+	flush := func() {
+		if inRecord {
+			records = append(records, namedSeq{name: name, seq: seq.String()})
+		}
+		seq.Reset()
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || trimmed[0] == ';':
+			continue
+		case trimmed[0] == '>':
+			flush()
+			name = headerName(trimmed[1:])
+			inRecord = true
+		default:
+			seq.WriteString(strings.ToUpper(trimmed))
+		}
+	}
+	flush()
+	return records
+}
+
+// headerName returns the first whitespace-delimited word of a FASTA header.
+func headerName(header string) string {
+	fields := strings.Fields(header)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// recordLocus returns the name of record rec and the offset of pos within it.
+// ok is false for unnamed records read from plain line-per-sequence input.
+func (g *Genome) recordLocus(rec, pos int) (name string, offset int, ok bool) {
+	if rec < 0 || rec >= len(g.Records) || g.Records[rec].Name == "" {
+		return "", 0, false
+	}
+	r := g.Records[rec]
+	return r.Name, pos - r.Start, true
+}
+
+// localSpan returns the span of text [pos, end) within record rec as 0-based
+// half-open offsets from the record's start. ok is false if rec is not a record.
+func (g *Genome) localSpan(rec, pos, end int) (start, stop int, ok bool) {
+	if rec < 0 || rec >= len(g.Records) {
+		return 0, 0, false
+	}
+	r := g.Records[rec]
+	return pos - r.Start, end - r.Start, true
+}
+
+// recordAt returns the index of the record containing text position pos, or -1
+// if pos is a separator or past the end, by binary search over the record
+// starts.
+func (g *Genome) recordAt(pos int) int {
+	i := sort.Search(len(g.Records), func(i int) bool { return g.Records[i].Start > pos }) - 1
+	if i < 0 || pos >= g.Records[i].Start+g.Records[i].Len {
+		return -1
+	}
+	return i
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGenomeFASTA(t *testing.T) {
+	// Two records, the first wrapped over several lines, with a description,
+	// a comment line and soft-masked bases.
+	data := ">chr1 first chromosome\nACGT\nacg\n;comment\nTT\n\n>chr2\nGGCC\n"
+	g, err := parseGenome([]byte(data), qualityFilter{})
+	if err != nil {
+		t.Fatalf("parseGenome: %v", err)
+	}
+
+	if g.Text != "ACGTACGTT$GGCC" {
+		t.Fatalf("Genome text: got %q, expected %q", g.Text, "ACGTACGTT$GGCC")
+	}
+	expectedRecords := []Record{
+		{Name: "chr1", Start: 0, Len: 9},
+		{Name: "chr2", Start: 10, Len: 4},
+	}
+	if !reflect.DeepEqual(g.Records, expectedRecords) {
+		t.Errorf("Records: got %v, expected %v", g.Records, expectedRecords)
+	}
+	expectedRecordAt := []int{0, 0, 0, 0, 0, 0, 0, 0, 0, -1, 1, 1, 1, 1}
+	for pos, expected := range expectedRecordAt {
+		if got := g.recordAt(pos); got != expected {
+			t.Errorf("recordAt(%d): got %d, expected %d", pos, got, expected)
+		}
+	}
+	if name, offset, ok := g.recordLocus(1, 12); !ok || name != "chr2" || offset != 2 {
+		t.Errorf("recordLocus(1, 12): got (%q, %d, %v), expected (\"chr2\", 2, true)", name, offset, ok)
+	}
+}
+
+func TestParseGenomePlainLines(t *testing.T) {
+	// Without a FASTA header every nonempty line is its own unnamed sequence.
+	g, err := parseGenome([]byte("ACGT\n\nTGCA\n"), qualityFilter{})
+	if err != nil {
+		t.Fatalf("parseGenome: %v", err)
+	}
+	if g.Text != "ACGT$TGCA" {
+		t.Fatalf("Genome text: got %q, expected %q", g.Text, "ACGT$TGCA")
+	}
+	if len(g.Records) != 2 || g.Records[1].Start != 5 {
+		t.Errorf("Unexpected records: %v", g.Records)
+	}
+	if _, _, ok := g.recordLocus(1, 5); ok {
+		t.Errorf("Plain line records should have no name")
+	}
+}
+
+func TestLocalSpan(t *testing.T) {
+	g, _ := parseGenome([]byte("ACGT\nTGCA\n"), qualityFilter{})
+	if start, end, ok := g.localSpan(1, 6, 9); !ok || start != 1 || end != 4 {
+		t.Errorf("localSpan(1, 6, 9): got (%d, %d, %v), expected (1, 4, true)", start, end, ok)
+	}
+	if _, _, ok := g.localSpan(-1, 4, 5); ok {
+		t.Errorf("localSpan should reject a separator position")
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// Index backends, chosen when the index is built.
+const (
+	// backendSA stores the full suffix array with LCP and genome text.
+	backendSA = "sa"
+	// backendFM stores an FM-index and locates hits through a sampled suffix array.
+	backendFM = "fm"
+)
+
+// indexOptions selects how buildIndex lays out an index.
+type indexOptions struct {
+	Backend string // backendSA (default) or backendFM
+	// SampleRate keeps the FM-index suffix array value of every SampleRate-th
+	// text position; 0 means defaultSampleRate.
+	SampleRate int
+}
+
+// Index is a search index together with the genome it was built from, so
+// searches can run from the index file alone. With the suffix array backend
+// the suffix array and LCP columns are either held in memory or viewed
+// directly over a mapped index file, and text is the genome packed at two bits
+// per base; with the FM-index backend fm is set and the genome text is not
+// kept. Either way entries find their record through the genome's record
+// table. Loaded indexes must be closed once searching is done.
+type Index struct {
+	SA          intArray
+	LCP         intArray
+	text        *packedSeq
+	fm          *fmIndex
+	Genome      *Genome
+	Fingerprint Fingerprint
+	unmap       func() error
+	// err records corruption met while searching an unverified index.
+	err error
+}
+
+// buildIndex constructs the suffix array of g using SAIS over the packed genome
+// and derives either the LCP entries or the FM-index from it. Only the record
+// table of g is kept: its text is fingerprinted and packed first, so the plain
+// text can be freed while the suffix array is built.
+func buildIndex(g *Genome, opts indexOptions) *Index {
+	idx := &Index{Genome: &Genome{Records: g.Records}, Fingerprint: g.Fingerprint()}
+	text := packSeq(g.Text)
+	sa := SAISText(text)
+	if opts.Backend == backendFM {
+		rate := opts.SampleRate
+		if rate == 0 {
+			rate = defaultSampleRate
+		}
+		// Hits are located through the FM-index; the text is not kept.
+		idx.fm = buildFMIndex(text, sa, rate)
+		return idx
+	}
+	idx.SA, idx.LCP, idx.text = sa, computeLCPText(text, sa), text
+	return idx
+}
+
+// Len returns the number of suffix array entries.
+func (idx *Index) Len() int {
+	if idx.fm != nil {
+		return idx.fm.n
+	}
+	return idx.SA.Len()
+}
+
+// Entry returns suffix array entry i, looking up its record in the record
+// table. The FM-index backend has no LCP values.
+func (idx *Index) Entry(i int) SuffixEntry {
+	if idx.fm != nil {
+		pos := idx.fm.locate(i)
+		return SuffixEntry{Pos: pos, Line: idx.Genome.recordAt(pos)}
+	}
+	pos := idx.SA.At(i)
+	return SuffixEntry{Pos: pos, Line: idx.Genome.recordAt(pos), LCP: idx.LCP.At(i)}
+}
+
+// interval returns the suffix array rows [lo, hi) of suffixes prefixed by query.
+func (idx *Index) interval(query string) (lo, hi int) {
+	if idx.fm != nil {
+		return idx.fm.interval(query)
+	}
+	lb := lowerBound(idx.text, idx.SA, query)
+	if lb == -1 {
+		return 0, 0
+	}
+	return lb, upperBound(idx.text, idx.SA, query)
+}
+
+// Err returns the corruption, if any, that searches have met in an index
+// loaded without verification. Results found since are not to be trusted.
+func (idx *Index) Err() error {
+	return idx.err
+}
+
+// Close releases the mapping behind a loaded index. Neither the index nor its
+// genome may be used afterwards.
+func (idx *Index) Close() error {
+	if idx.unmap == nil {
+		return nil
+	}
+	unmap := idx.unmap
+	idx.unmap = nil
+	return unmap()
+}
+
+// intArray is a read-only array of integers.
+type intArray interface {
+	Len() int
+	At(i int) int
+}
+
+// intSlice is an intArray held in memory.
+type intSlice []int
+
+func (s intSlice) Len() int     { return len(s) }
+func (s intSlice) At(i int) int { return s[i] }
+
+// int32Slice is an intArray of positions held in memory at 32 bits each.
+type int32Slice []int32
+
+func (s int32Slice) Len() int     { return len(s) }
+func (s int32Slice) At(i int) int { return int(s[i]) }
+
+// toInts copies an intArray into a slice.
+func toInts(a intArray) []int {
+	s := make([]int, a.Len())
+	for i := range s {
+		s[i] = a.At(i)
+	}
+	return s
+}
+
+// checkedPositions is an intArray of text positions read from an unverified
+// index, each of which must be below limit. The first value out of range is
+// recorded in *err and read as 0, so searches run to completion and the
+// caller reports the corruption (see Index.Err) rather than their results.
+type checkedPositions struct {
+	intArray
+	limit int
+	err   *error
+}
+
+func (c checkedPositions) At(i int) int {
+	pos := c.intArray.At(i)
+	if pos < 0 || pos >= c.limit {
+		corrupt(c.err, "suffix position %d out of range at entry %d", pos, i)
+		return 0
+	}
+	return pos
+}
+
+// corrupt records in *err, unless it already holds one, the corruption met
+// while searching an unverified index.
+func corrupt(err *error, format string, a ...any) {
+	if *err == nil {
+		*err = fmt.Errorf("index: "+format+"; the index is corrupt, rebuild it with -m", a...)
+	}
+}
+
+// leInt32s and leInt64s are intArrays decoded on access from little-endian
+// fixed-width index sections, so they can sit directly on mapped pages.
+type leInt32s []byte
+
+func (b leInt32s) Len() int     { return len(b) / 4 }
+func (b leInt32s) At(i int) int { return int(int32(binary.LittleEndian.Uint32(b[i*4:]))) }
+
+type leInt64s []byte
+
+func (b leInt64s) Len() int     { return len(b) / 8 }
+func (b leInt64s) At(i int) int { return int(int64(binary.LittleEndian.Uint64(b[i*8:]))) }
+
+// Fingerprint is a SHA-256 digest of the genome text and its record table.
+type Fingerprint [sha256.Size]byte
+
+func (f Fingerprint) String() string {
+	return hex.EncodeToString(f[:])
+}
+
+// Fingerprint identifies the exact concatenated text and record boundaries of g.
+func (g *Genome) Fingerprint() Fingerprint {
+	h := sha256.New()
+	h.Write(encodeRecords(g.Records))
+	h.Write([]byte(g.Text))
+	var f Fingerprint
+	h.Sum(f[:0])
+	return f
+}
+
+// checkGenome returns an error if g is not the genome the index was built from.
+func (idx *Index) checkGenome(g *Genome) error {
+	want, got := idx.Fingerprint, g.Fingerprint()
+	if want != got {
+		return fmt.Errorf("genome does not match index (index fingerprint %s, genome fingerprint %s); rebuild the index with -m", want, got)
+	}
+	return nil
+}
+
+// encodeRecords serialises a record table: a record count followed by start,
+// length and name of every record.
+func encodeRecords(records []Record) []byte {
+	var buf []byte
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(records)))
+	for _, r := range records {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(r.Start))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(r.Len))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(r.Name)))
+		buf = append(buf, r.Name...)
+	}
+	return buf
+}
+
+// decodeRecords parses a record table written by encodeRecords, checking that
+// every record lies within a text of textLen bytes.
+func decodeRecords(b []byte, textLen int) ([]Record, error) {
+	if len(b) < 8 {
+		return nil, fmt.Errorf("truncated record table")
+	}
+	n := binary.LittleEndian.Uint64(b)
+	b = b[8:]
+	if n > uint64(len(b))/20 {
+		return nil, fmt.Errorf("record count %d exceeds record table size", n)
+	}
+	records := make([]Record, 0, n)
+	for i := uint64(0); i < n; i++ {
+		if len(b) < 20 {
+			return nil, fmt.Errorf("truncated record %d", i)
+		}
+		start := binary.LittleEndian.Uint64(b)
+		length := binary.LittleEndian.Uint64(b[8:])
+		nameLen := uint64(binary.LittleEndian.Uint32(b[16:]))
+		b = b[20:]
+		if nameLen > uint64(len(b)) {
+			return nil, fmt.Errorf("truncated name of record %d", i)
+		}
+		if start > uint64(textLen) || length > uint64(textLen)-start {
+			return nil, fmt.Errorf("record %d (start %d, length %d) outside text of %d bytes", i, start, length, textLen)
+		}
+		records = append(records, Record{Name: string(b[:nameLen]), Start: int(start), Len: int(length)})
+		b = b[nameLen:]
+	}
+	return records, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import "fmt"
+
+// defaultMaxExpansions caps the number of concrete sequences one degenerate
+// query or pattern may stand for.
+const defaultMaxExpansions = 4096
+
+// iupacBases maps every degenerate IUPAC nucleotide code to the bytes it
+// matches: the bases it stands for and the code itself, so an N in a query
+// still matches an N in the genome. Other bytes match only themselves.
+var iupacBases = func() [256]string {
+	var bases [256]string
+	for code, set := range map[byte]string{
+		'R': "AG", 'Y': "CT", 'S': "CG", 'W': "AT", 'K': "GT", 'M': "AC",
+		'B': "CGT", 'D': "AGT", 'H': "ACT", 'V': "ACG", 'N': "ACGT",
+	} {
+		bases[code] = set + string(code)
+	}
+	return bases
+}()
+
+// baseMatches reports whether text byte c matches query byte q.
+func baseMatches(q, c byte) bool {
+	if c == q {
+		return true
+	}
+	for i := 0; i < len(iupacBases[q]); i++ {
+		if iupacBases[q][i] == c {
+			return true
+		}
+	}
+	return false
+}
+
+// isDegenerate reports whether seq contains any degenerate IUPAC code.
+func isDegenerate(seq string) bool {
+	for i := 0; i < len(seq); i++ {
+		if iupacBases[seq[i]] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExpansions returns an error if seq stands for more than limit concrete
+// sequences.
+func checkExpansions(seq string, limit int) error {
+	count := 1
+	for i := 0; i < len(seq); i++ {
+		if set := iupacBases[seq[i]]; set != "" {
+			count *= len(set)
+			if count > limit {
+				return fmt.Errorf("%q expands to more than %d sequences (raise -maxexpand)", seq, limit)
+			}
+		}
+	}
+	return nil
+}
+
+// expandedMatch reports whether the text matched on strand by a degenerate
+// query differs from the query itself, so is worth reporting.
+func expandedMatch(query string, strand byte, matched string) bool {
+	if !isDegenerate(query) {
+		return false
+	}
+	if strand == '-' {
+		query = reverseComplement(query)
+	}
+	return matched != query
+}
+
+// expandIUPAC returns every concrete sequence seq stands for, in order. The
+// caller checks the expansion size first.
+func expandIUPAC(seq string) []string {
+	variants := []string{""}
+	for i := 0; i < len(seq); i++ {
+		set := iupacBases[seq[i]]
+		if set == "" {
+			set = seq[i : i+1]
+		}
+		next := make([]string, 0, len(variants)*len(set))
+		for _, v := range variants {
+			for j := 0; j < len(set); j++ {
+				next = append(next, v+set[j:j+1])
+			}
+		}
+		variants = next
+	}
+	return variants
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExpandIUPAC(t *testing.T) {
+	got := expandIUPAC("ARC")
+	expected := []string{"AAC", "AGC", "ARC"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expandIUPAC(ARC): got %v, expected %v", got, expected)
+	}
+	if err := checkExpansions("NNN", 125); err != nil {
+		t.Errorf("NNN within 125 expansions: %v", err)
+	}
+	if err := checkExpansions("NNNN", 125); err == nil || !strings.Contains(err.Error(), "-maxexpand") {
+		t.Errorf("NNNN beyond 125 expansions: got %v", err)
+	}
+}
+
+func TestDegenerateSearchMatchesExpansion(t *testing.T) {
+	// Searching a degenerate query finds exactly the union of the hits of its
+	// concrete expansions, each reporting the expansion it matched.
+	rng := rand.New(rand.NewSource(5))
+	g := randomGenome(rng, 2, 300)
+	opts := searchOptions{Strand: strandForward, MaxExpansions: defaultMaxExpansions}
+	for _, backend := range []string{backendSA, backendFM} {
+		idx := buildIndex(g, indexOptions{Backend: backend})
+		for _, query := range []string{"ANGT", "RYN", "GGSWC", "NNNNN"} {
+			var expected []string
+			for _, seq := range expandIUPAC(query) {
+				for _, entry := range searchSequence(idx, seq) {
+					expected = append(expected, fmt.Sprintf("%s@%d", seq, entry.Pos))
+				}
+			}
+			hits, err := searchQuery(idx, query, opts)
+			if err != nil {
+				t.Fatalf("searchQuery(%q): %v", query, err)
+			}
+			var got []string
+			for _, hit := range hits {
+				if g.Text[hit.Pos:hit.End] != hit.Matched {
+					t.Errorf("%s: query %q hit at %d matched %q, text is %q", backend, query, hit.Pos, hit.Matched, g.Text[hit.Pos:hit.End])
+				}
+				got = append(got, fmt.Sprintf("%s@%d", hit.Matched, hit.Pos))
+			}
+			sort.Strings(got)
+			sort.Strings(expected)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("%s: query %q found %d hits, expected %d", backend, query, len(got), len(expected))
+			}
+		}
+	}
+}
@@ -1,29 +1,58 @@
 package main
 
+import "math"
+
 // computeLCP computes the Longest Common Prefix array using Kasai's algorithm.
 func computeLCP(s string, sa []int) []int {
-	n := len(sa)
-	lcp := make([]int, n)
-	rank := make([]int, n)
-	for i, pos := range sa {
-		if pos < n {
-			rank[pos] = i
-		}
+	return toInts(computeLCPText(stringSeq(s), intSlice(sa)))
+}
+
+// computeLCPText is computeLCP over any byteSeq, such as a packed genome. It
+// computes the LCP values in text order (the permuted LCP array) through the Φ
+// array, which it overwrites in place, so besides sa only one array of
+// positions is allocated, 32-bit whenever they fit. The returned array reads
+// the LCP of suffix array entry i through sa.
+func computeLCPText(s byteSeq, sa intArray) intArray {
+	if sa.Len() < math.MaxInt32 {
+		return permutedLCP(s, sa, make(int32Slice, sa.Len()))
+	}
+	return permutedLCP(s, sa, make(intSlice, sa.Len()))
+}
+
+func permutedLCP[I suffixInt, A interface {
+	~[]I
+	intArray
+}](s byteSeq, sa intArray, plcp A) intArray {
+	n := sa.Len()
+	// Φ maps every suffix to the one preceding it in sa, -1 for the first.
+	prev := -1
+	for i := 0; i < n; i++ {
+		pos := sa.At(i)
+		plcp[pos] = I(prev)
+		prev = pos
 	}
 	h := 0
 	for i := 0; i < n; i++ {
-		if rank[i] > 0 {
-			j := sa[rank[i]-1]
-			for i+h < len(s) && j+h < len(s) && s[i+h] == s[j+h] {
-				h++
-			}
-			lcp[rank[i]] = h
-			if h > 0 {
-				h--
-			}
-		} else {
-			lcp[rank[i]] = 0
+		j := int(plcp[i])
+		if j < 0 {
+			plcp[i], h = 0, 0
+			continue
+		}
+		for i+h < s.Len() && j+h < s.Len() && s.At(i+h) == s.At(j+h) {
+			h++
+		}
+		plcp[i] = I(h)
+		if h > 0 {
+			h--
 		}
 	}
-	return lcp
+	return lcpArray{plcp: plcp, sa: sa}
 }
+
+// lcpArray is an LCP array read from the permuted LCP array in text order.
+type lcpArray struct {
+	plcp, sa intArray
+}
+
+func (a lcpArray) Len() int     { return a.sa.Len() }
+func (a lcpArray) At(i int) int { return a.plcp.At(a.sa.At(i)) }
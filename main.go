@@ -4,10 +4,19 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 )
 
-// SuffixEntry holds the suffix array entry, the originating line, and LCP value.
+// defaultIndexPath is the index file used when no -i flag is given.
+const defaultIndexPath = "sa.idx"
+
+// SuffixEntry holds the suffix array entry, the originating record, and LCP value.
+// Line is the record index: the line number for plain input, or the position
+// of the record within a FASTA file. It is looked up from the record table
+// rather than stored per entry.
 type SuffixEntry struct {
 	Pos  int
 	Line int
@@ -21,116 +30,497 @@ func main() {
 func runApp(args []string) {
 	fs := flag.NewFlagSet("dnatools", flag.ExitOnError)
 	indexMode := fs.Bool("m", false, "Index mode: build suffix array index")
+	backend := fs.String("backend", backendSA, "Index backend for -m: "+backendSA+" (suffix array with LCP) or "+backendFM+" (FM-index, smaller)")
+	sampleRate := fs.Int("sample", defaultSampleRate, "FM-index suffix array sampling rate for -m: keep every k-th text position (smaller locates faster, larger saves memory)")
 	searchQueryStr := fs.String("s", "", "Search mode: search for sequence using suffix array")
 	trieFile := fs.String("t", "", "Trie search mode: file containing multiple query patterns (one per line)")
-	fileName := fs.String("f", "genoma.txt", "Genome file name")
+	motifStr := fs.String("motif", "", "Motif search mode: search for a motif such as TATA[AT]A[AT] or CAG.{2,5}CTG using suffix array ([...] classes, [^...] exclusions, . or x for any base, {m,n} or (m,n) repeats)")
+	queryFile := fs.String("q", "", "Batch search mode: search every query of a plain (one per line), FASTA or FASTQ file, or of standard input if -, using suffix array; results are labelled by read name or query number")
+	sortQueries := fs.Bool("sorted", false, "With -q, search the queries in sorted order so each one reuses the suffix array bounds of the previous one")
+	var fileNames, indexPaths stringList
+	fs.Var(&fileNames, "f", "Genome file name; repeat to pair several genomes with several -i indexes (default genoma.txt, optional for -s and -q, which use the genome stored in the index)")
+	fs.Var(&indexPaths, "i", "Index file as path or name=path; repeat to build or query several named indexes (default "+defaultIndexPath+")")
+	maxDist := fs.Int("k", 0, "Allow up to k substitutions (Hamming distance) in -s and -q hits, reported with their mismatch offsets")
+	format := fs.String("format", formatText, "Output format: "+formatText+", "+formatJSON+" (one array of results), "+formatJSONL+" (one result per line, as each completes), "+formatBED+" (BED6) or "+formatGFF3+" features of the -s, -q, -motif and -t hits on their records, or "+formatSAM+" alignments of the -s, -q and -motif hits")
+	coords := fs.Bool("coords", false, "Also report record-local coordinates of every hit, 0-based half-open [start, end) and 1-based closed [start, end]")
+	countOnly := fs.Bool("count", false, "With -s, -q or -motif, print only the number of hits of each query, computed from suffix array intervals without locating them (except for edit distance searches and motifs of varying length)")
+	existsOnly := fs.Bool("exists", false, "With -s, -q or -motif, print only whether each query occurs")
+	order := fs.String("order", orderInput, "Order of -t patterns in the report: "+orderInput+" (as in the pattern file) or "+orderPosition+" (by first hit, patterns not found last)")
+	limit := fs.Int("limit", 0, "With -s, -q or -motif, locate and print at most this many hits per query (0 prints all)")
+	maxExpansions := fs.Int("maxexpand", defaultMaxExpansions, "Refuse -s, -q and -t queries whose degenerate IUPAC codes (R, Y, N, ...) stand for more than this many concrete sequences")
+	indels := fs.Bool("indels", false, "With -k, allow insertions and deletions too (edit distance); hits report their end, distance and CIGAR")
+	strandFlag := fs.String("strand", strandForward, "Strands searched by -s, -q and -t: "+strandForward+" (forward, as written), "+strandReverse+" (reverse complement) or "+strandBoth+"; hits report their strand unless "+strandForward)
+	verify := fs.Bool("verify", false, "Verify the index checksum and genome fingerprint before searching (reads the whole index)")
+	trimQual := fs.Int("trimq", 0, "Trim FASTQ read 3' ends below this Phred quality (0 disables)")
+	minQual := fs.Int("minq", 0, "Drop FASTQ reads whose mean Phred quality is below this (0 disables)")
 	fs.Parse(args)
-
-	// Read genome file.
-	data, err := os.ReadFile(*fileName)
+	qf := qualityFilter{TrimQual: *trimQual, MinQual: *minQual}
+	sampleGiven := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "sample" {
+			sampleGiven = true
+		}
+	})
+	strand, err := parseStrand(*strandFlag)
 	if err != nil {
-		fmt.Println("Error reading genome file:", err)
+		fmt.Println("Error:", err)
 		os.Exit(1)
 	}
-
-	// Build genome from file lines. Each nonempty line is a DNA sequence.
-	lines := strings.Split(string(data), "\n")
-	var sequences []string
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if trimmed != "" {
-			sequences = append(sequences, trimmed)
-		}
+	if *maxDist < 0 {
+		fmt.Println("Error: -k must not be negative")
+		os.Exit(1)
 	}
-	var genomeBuilder strings.Builder
-	var lineMap []int
-	for i, seq := range sequences {
-		for _, ch := range seq {
-			genomeBuilder.WriteRune(ch)
-			lineMap = append(lineMap, i) // record originating line index
-		}
-		// Append a separator if not the last sequence.
-		if i < len(sequences)-1 {
-			genomeBuilder.WriteByte('$')
-			lineMap = append(lineMap, -1) // -1 indicates separator
+	if *countOnly && *existsOnly {
+		fmt.Println("Error: -count and -exists cannot be combined")
+		os.Exit(1)
+	}
+	if *limit < 0 {
+		fmt.Println("Error: -limit must not be negative")
+		os.Exit(1)
+	}
+	if *order != orderInput && *order != orderPosition {
+		fmt.Printf("Error: unknown -order %q (use %s or %s)\n", *order, orderInput, orderPosition)
+		os.Exit(1)
+	}
+	if *indels && *maxDist == 0 {
+		fmt.Println("Error: -indels needs -k to set the edit distance")
+		os.Exit(1)
+	}
+	searchOpts := searchOptions{Strand: strand, MaxDist: *maxDist, Indels: *indels, MaxExpansions: *maxExpansions, Limit: *limit}
+	genomeGiven := len(fileNames) > 0
+	if !genomeGiven {
+		fileNames = stringList{"genoma.txt"}
+	}
+	if len(indexPaths) == 0 {
+		indexPaths = stringList{defaultIndexPath}
+	}
+	specs := make([]indexSpec, len(indexPaths))
+	for i, p := range indexPaths {
+		specs[i] = parseIndexSpec(p)
+	}
+	rep, err := newReporter(*format, reportOptions{
+		Search:      searchOpts,
+		Coords:      *coords,
+		CountOnly:   *countOnly,
+		Exists:      *existsOnly,
+		MultiIndex:  len(specs) > 1,
+		MultiGenome: len(fileNames) > 1,
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	defer rep.close()
+	// Errors from here on close the report before exiting.
+	fail := func(a ...any) { fatal(rep, a...) }
+	failf := func(format string, a ...any) { fatal(rep, fmt.Sprintf(format, a...)) }
+	// Genomes pair up with indexes by position whenever both are involved.
+	pairGenomes := func() {
+		if len(fileNames) != len(specs) {
+			failf("Error: %d genome files (-f) given for %d indexes (-i); they are paired in order.", len(fileNames), len(specs))
 		}
 	}
-	genome := genomeBuilder.String()
 
-	// Index mode using suffix array (with LCP) remains as before.
+	// Index mode using suffix array (with LCP); the genome is stored in the index.
 	if *indexMode {
-		fmt.Println("Building suffix array index using SAIS algorithm...")
-		encoded, alphabetSize := encodeString(genome)
-		sa := SAISEntryPoint(encoded, alphabetSize)
-		lcp := computeLCP(genome, sa)
-		entries := make([]SuffixEntry, len(sa))
-		for i, pos := range sa {
-			lineNum := -1
-			if pos < len(lineMap) {
-				lineNum = lineMap[pos]
-			}
-			entries[i] = SuffixEntry{Pos: pos, Line: lineNum, LCP: lcp[i]}
-		}
-		err = saveIndex("sa.idx", entries)
-		if err != nil {
-			fmt.Println("Error saving index:", err)
-			os.Exit(1)
+		if *backend != backendSA && *backend != backendFM {
+			failf("Error: unknown index backend %q (use %s or %s)", *backend, backendSA, backendFM)
 		}
-		fmt.Println("Index built and saved to sa.idx")
-		// Suffix array search mode.
-	} else if *searchQueryStr != "" {
-		entries, err := loadIndex("sa.idx")
-		if err != nil {
-			fmt.Println("Error loading index:", err)
-			os.Exit(1)
+		if *sampleRate < 1 {
+			fail("Error: -sample must be at least 1")
 		}
-		fmt.Printf("Searching for sequence: %s\n", *searchQueryStr)
-		results := searchSequence(genome, entries, *searchQueryStr)
-		if len(results) == 0 {
-			fmt.Println("Sequence not found.")
-		} else {
-			fmt.Println("Sequence found at positions (global position, DNA line):")
-			for _, entry := range results {
-				fmt.Printf("(%d, %d) ", entry.Pos, entry.Line)
+		if sampleGiven && *backend != backendFM {
+			fail("Error: -sample applies to the FM-index only; use it with -backend fm")
+		}
+		pairGenomes()
+		opts := indexOptions{Backend: *backend, SampleRate: *sampleRate}
+		for i, spec := range specs {
+			rep.indexStarted(*backend)
+			g, err := readGenome(fileNames[i], qf)
+			if err != nil {
+				fail("Error", err)
+			}
+			idx := buildIndex(g, opts)
+			if err := saveIndex(spec.Path, idx); err != nil {
+				fail("Error saving index:", err)
+			}
+			stats := indexStats{
+				Index:   spec.Name,
+				Path:    spec.Path,
+				Genome:  fileNames[i],
+				Backend: *backend,
+				Records: len(idx.Genome.Records),
+				Length:  idx.Len() - 1,
+				Entries: idx.Len(),
+			}
+			if idx.fm != nil {
+				stats.SampleRate, stats.Samples = idx.fm.sampleRate, idx.fm.samples.Len()
+			}
+			rep.indexBuilt(stats)
+		}
+		// Suffix array search modes: a single -s sequence, every read of -q or
+		// a -motif, run against each index in turn.
+	} else if *searchQueryStr != "" || *queryFile != "" || *motifStr != "" {
+		if genomeGiven {
+			pairGenomes()
+		}
+		var m motif
+		if *motifStr != "" {
+			if *maxDist > 0 {
+				fail("Error: -k applies to -s and -q only; motifs are matched exactly")
+			}
+			// Motifs are matched against the upper-cased genome like -s.
+			if m, err = parseMotif(strings.ToUpper(*motifStr)); err != nil {
+				fail("Error:", err)
 			}
-			fmt.Println()
+		}
+		opts := searchOpts
+		queries := []namedSeq{{seq: strings.ToUpper(*searchQueryStr)}}
+		if *queryFile != "" {
+			if queries, err = readQueries(*queryFile, qf); err != nil {
+				fail("Error", err)
+			}
+			// Plain queries are identified by their 1-based number.
+			for i := range queries {
+				if queries[i].name == "" {
+					queries[i].name = strconv.Itoa(i + 1)
+				}
+			}
+		}
+		for i, spec := range specs {
+			idx, err := openIndex(spec.Path, *verify)
+			if err != nil {
+				fail("Error loading index:", err)
+			}
+			// Results are reported only if the searches behind them found the
+			// index intact.
+			report := func(r queryResult) {
+				if err := idx.Err(); err != nil {
+					failf("Error: index %s: %v", spec.Name, err)
+				}
+				rep.queryDone(r)
+			}
+			// An explicit -f must be the genome the index was built from.
+			if genomeGiven {
+				g, err := readGenome(fileNames[i], qf)
+				if err != nil {
+					fail("Error", err)
+				}
+				if err := idx.checkGenome(g); err != nil {
+					failf("Error: index %s: %v", spec.Name, err)
+				}
+			}
+			if m != nil {
+				r := queryResult{Index: spec, Genome: idx.Genome, Query: *motifStr, Motif: true}
+				if *countOnly || *existsOnly {
+					r.Total = countMotif(idx, m, strand, *existsOnly)
+				} else {
+					// Motif hits are located to report each start once, so
+					// the count is their number and the limit only trims
+					// the report.
+					r.Hits = searchMotif(idx, m, strand)
+					r.Total = len(r.Hits)
+					if *limit > 0 && r.Total > *limit {
+						r.Hits = r.Hits[:*limit]
+					}
+				}
+				report(r)
+				idx.Close()
+				continue
+			}
+			batch := queries
+			if *sortQueries {
+				batch = sortForIndex(idx, queries)
+				opts.Bounds = &intervalCache{}
+			}
+			for _, q := range batch {
+				r := queryResult{Index: spec, Genome: idx.Genome, ID: q.name, Query: q.seq}
+				if *countOnly || *existsOnly {
+					if r.Total, err = countQuery(idx, q.seq, opts); err != nil {
+						fail("Error: query", err)
+					}
+					report(r)
+					continue
+				}
+				if r.Hits, err = searchQuery(idx, q.seq, opts); err != nil {
+					fail("Error: query", err)
+				}
+				r.Total = len(r.Hits)
+				if *limit > 0 && r.Total == *limit {
+					r.Total, _ = countQuery(idx, q.seq, opts)
+				}
+				report(r)
+			}
+			idx.Close()
 		}
 		// Trie search mode: used with the -t flag.
 	} else if *trieFile != "" {
-		// Read the file containing multiple query patterns.
-		patternData, err := os.ReadFile(*trieFile)
+		if *maxDist > 0 {
+			fail("Error: -k applies to -s and -q only; trie search is exact")
+		}
+		if *format == formatSAM {
+			fail("Error: -format sam needs the records of an index; use -s, -q or -motif")
+		}
+		// Read the file containing multiple query patterns, keeping the read
+		// IDs of FASTA/FASTQ patterns for the report.
+		queries, err := readQueries(*trieFile, qf)
 		if err != nil {
-			fmt.Println("Error reading trie file:", err)
-			os.Exit(1)
+			fail("Error", err)
 		}
-		patternLines := strings.Split(string(patternData), "\n")
+		ids := make(map[string][]string)
 		var patterns []string
-		for _, l := range patternLines {
-			trimmed := strings.TrimSpace(l)
-			if trimmed != "" {
-				patterns = append(patterns, trimmed)
+		for _, q := range queries {
+			patterns = append(patterns, q.seq)
+			if q.name != "" {
+				ids[q.seq] = append(ids[q.seq], q.name)
 			}
 		}
-		// Build the trie from the query patterns.
+		// Build the trie from the query patterns, reverse complemented as
+		// -strand selects.
 		trie := NewTrie()
-		for _, pat := range patterns {
-			trie.Insert(pat)
-		}
-		// Search the genome using the trie.
-		results := searchTrie(genome, trie)
-		// Print results, annotating each found position with its DNA line from lineMap.
-		for pat, positions := range results {
-			var annotated []string
-			for _, pos := range positions {
-				lineNum := -1
-				if pos < len(lineMap) {
-					lineNum = lineMap[pos]
-				}
-				annotated = append(annotated, fmt.Sprintf("(%d, line %d)", pos, lineNum))
+		targets, err := strandTrie(trie, patterns, strand, *maxExpansions)
+		if err != nil {
+			fail("Error: pattern", err)
+		}
+		// Stream every genome through the trie without loading it.
+		for _, fileName := range fileNames {
+			results, err := streamTrieSearch(fileName, qf, trie)
+			if err != nil {
+				fail("Error scanning genome file:", err)
+			}
+			// Every pattern is reported, found or not, in a stable order.
+			oriented := orientTrieHits(results, targets)
+			var found []patternResult
+			for _, pat := range orderPatterns(patterns, oriented, *order == orderPosition) {
+				found = append(found, patternResult{Genome: fileName, Pattern: pat, IDs: ids[pat], Hits: oriented[pat]})
 			}
-			fmt.Printf("Pattern %q found at positions: %v\n", pat, annotated)
+			rep.patternsDone(fileName, found)
 		}
 	} else {
-		fmt.Println("Please provide -m to build index, -s <sequence> for suffix array search, or -t <file> for trie search (used with -f).")
+		fmt.Println("Please provide -m to build index, -s <sequence>, -q <file> or -motif <motif> for suffix array search, or -t <file> for trie search (used with -f).")
+	}
+}
+
+// fatal ends runApp after an error, printing its message like fmt.Println.
+// The report is closed first, so JSON output stays well formed, and only the
+// text report shares standard output with the message; other formats get it
+// on standard error.
+func fatal(rep reporter, a ...any) {
+	rep.close()
+	w := os.Stderr
+	if _, ok := rep.(*textReporter); ok {
+		w = os.Stdout
+	}
+	fmt.Fprintln(w, a...)
+	os.Exit(1)
+}
+
+// Orders of -t patterns in the report.
+const (
+	orderInput    = "input"
+	orderPosition = "position"
+)
+
+// orderPatterns returns the distinct patterns in the order they were given or,
+// if byPosition, by the position of their first hit (hits are sorted by
+// orientTrieHits), with the patterns not found last in the order given.
+func orderPatterns(patterns []string, hits map[string][]trieHit, byPosition bool) []string {
+	seen := make(map[string]bool)
+	var ordered []string
+	for _, pat := range patterns {
+		if !seen[pat] {
+			seen[pat] = true
+			ordered = append(ordered, pat)
+		}
+	}
+	if byPosition {
+		sort.SliceStable(ordered, func(i, j int) bool {
+			a, b := hits[ordered[i]], hits[ordered[j]]
+			if len(a) == 0 || len(b) == 0 {
+				return len(b) == 0 && len(a) > 0
+			}
+			return a[0].Pos < b[0].Pos
+		})
+	}
+	return ordered
+}
+
+// printTrieResults prints the trie hits of every pattern, annotating each found
+// position with its record (and strand, if showStrand, and the sequence
+// matched, where degenerate codes matched other bases, and its record-local
+// coordinates, if coords) and each pattern with its read IDs. Patterns without
+// hits are reported as not found.
+func printTrieResults(results []patternResult, showStrand, coords bool) {
+	for _, r := range results {
+		pat, hits := r.Pattern, r.Hits
+		var annotated []string
+		for _, hit := range hits {
+			var a string
+			if hit.Name != "" {
+				a = fmt.Sprintf("(%d, %s:%d", hit.Pos, hit.Name, hit.Offset)
+			} else {
+				a = fmt.Sprintf("(%d, line %d", hit.Pos, hit.Record)
+			}
+			if showStrand {
+				a += fmt.Sprintf(", %c", hit.Strand)
+			}
+			if expandedMatch(pat, hit.Strand, hit.Matched) {
+				a += ", matched " + hit.Matched
+			}
+			if coords {
+				a += localCoords(hit.Offset, hit.Offset+len(hit.Matched))
+			}
+			annotated = append(annotated, a+")")
+		}
+		label := fmt.Sprintf("%q", pat)
+		if len(r.IDs) > 0 {
+			label += " (" + strings.Join(r.IDs, ",") + ")"
+		}
+		if len(hits) == 0 {
+			fmt.Printf("Pattern %s not found.\n", label)
+		} else {
+			fmt.Printf("Pattern %s found at positions: %v\n", label, annotated)
+		}
+	}
+}
+
+// localCoords formats the record-local span [start, end) of a hit in both
+// conventions: 0-based half-open as in BED, and 1-based closed as in GFF.
+func localCoords(start, end int) string {
+	return fmt.Sprintf(", [%d, %d) 0-based, [%d, %d] 1-based", start, end, start+1, end)
+}
+
+// printCount prints the number of hits of a query, or only whether it has any
+// if exists is set.
+func printCount(count int, exists bool) {
+	switch {
+	case exists && count > 0:
+		fmt.Println("Sequence found.")
+	case exists:
+		fmt.Println("Sequence not found.")
+	default:
+		fmt.Printf("Sequence found %d times.\n", count)
+	}
+}
+
+// printLimited notes how many hits -limit left out of the report.
+func printLimited(shown, total int) {
+	if total > shown {
+		fmt.Printf("Showing %d of %d hits; raise -limit to see more.\n", shown, total)
+	}
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// indexSpec is an index named on the command line, given as "path" or
+// "name=path". Unnamed indexes are named after their file.
+type indexSpec struct {
+	Name string
+	Path string
+}
+
+func parseIndexSpec(s string) indexSpec {
+	if name, path, ok := strings.Cut(s, "="); ok && name != "" {
+		return indexSpec{Name: name, Path: path}
+	}
+	base := filepath.Base(s)
+	return indexSpec{Name: strings.TrimSuffix(base, filepath.Ext(base)), Path: s}
+}
+
+// readGenome reads and parses the genome file: (multi-)FASTA records, FASTQ
+// reads or one sequence per nonempty line.
+func readGenome(fileName string, qf qualityFilter) (*Genome, error) {
+	data, err := readInput(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("reading genome file: %w", err)
+	}
+	g, err := parseGenome(data, qf)
+	if err != nil {
+		return nil, fmt.Errorf("parsing genome file: %w", err)
+	}
+	return g, nil
+}
+
+// readQueries loads the query patterns of a plain, FASTA or FASTQ file.
+func readQueries(fileName string, qf qualityFilter) ([]namedSeq, error) {
+	patternData, err := readInput(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("reading query file: %w", err)
+	}
+	queries, err := parseQueries(patternData, qf)
+	if err != nil {
+		return nil, fmt.Errorf("parsing query file: %w", err)
+	}
+	return queries, nil
+}
+
+// printSearchResults prints suffix array hits as (global position, DNA line),
+// using record name and offset for named records. The strand follows when both
+// strands may be searched, then the mismatches of a Hamming search or the end,
+// distance and CIGAR of an edit distance search, then the sequence matched
+// wherever degenerate IUPAC codes matched other bases, and finally the
+// record-local coordinates if coords is set.
+func printSearchResults(g *Genome, query string, results []searchHit, opts searchOptions, coords bool) {
+	if len(results) == 0 {
+		fmt.Println("Sequence not found.")
+		return
+	}
+	showStrand := opts.Strand != strandForward
+	showMismatches := opts.MaxDist > 0 && !opts.Indels
+	showEdits := opts.MaxDist > 0 && opts.Indels
+	showMatched := false
+	for _, hit := range results {
+		showMatched = showMatched || expandedMatch(query, hit.Strand, hit.Matched)
+	}
+	columns := "global position, DNA line"
+	if showStrand {
+		columns += ", strand"
+	}
+	if showMismatches {
+		columns += ", mismatches"
+	}
+	if showEdits {
+		columns += ", end, distance, CIGAR"
+	}
+	if showMatched {
+		columns += ", matched"
+	}
+	if coords {
+		columns += ", record coordinates"
+	}
+	fmt.Printf("Sequence found at positions (%s):\n", columns)
+	for _, hit := range results {
+		if name, offset, ok := g.recordLocus(hit.Line, hit.Pos); ok {
+			fmt.Printf("(%d, %s:%d", hit.Pos, name, offset)
+		} else {
+			fmt.Printf("(%d, %d", hit.Pos, hit.Line)
+		}
+		if showStrand {
+			fmt.Printf(", %c", hit.Strand)
+		}
+		if showMismatches {
+			fmt.Printf(", mismatches %d %v", len(hit.Mismatches), hit.Mismatches)
+		}
+		if showEdits {
+			fmt.Printf(", end %d, distance %d, %s", hit.End, hit.Distance, hit.CIGAR)
+		}
+		if showMatched && expandedMatch(query, hit.Strand, hit.Matched) {
+			fmt.Printf(", matched %s", hit.Matched)
+		}
+		if start, end, ok := g.localSpan(hit.Line, hit.Pos, hit.End); coords && ok {
+			fmt.Print(localCoords(start, end))
+		}
+		fmt.Print(") ")
 	}
+	fmt.Println()
 }
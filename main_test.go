@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"os"
 	"strings"
 	"testing"
@@ -153,8 +154,9 @@ func TestSearchModeOutput(t *testing.T) {
 	origArgs := os.Args
 	origStdout := os.Stdout
 
-	// First, build the index.
-	os.Args = []string{"cmd", "-m", "-f", genomeFile}
+	// First, build the index in the temporary directory.
+	indexFile := tempDir + "/sa.idx"
+	os.Args = []string{"cmd", "-m", "-f", genomeFile, "-i", indexFile}
 	_, w1, err := os.Pipe()
 	if err != nil {
 		t.Fatalf("Failed to create pipe: %v", err)
@@ -165,7 +167,7 @@ func TestSearchModeOutput(t *testing.T) {
 	os.Stdout = origStdout
 
 	// Now, run the search mode for the query "ana".
-	os.Args = []string{"cmd", "-s", "ana", "-f", genomeFile}
+	os.Args = []string{"cmd", "-s", "ana", "-f", genomeFile, "-i", indexFile}
 	r2, w2, err := os.Pipe()
 	if err != nil {
 		t.Fatalf("Failed to create pipe: %v", err)
@@ -198,8 +200,7 @@ func TestSearchModeOutput(t *testing.T) {
 		t.Errorf("Expected search result positions for query 'ana', got output: %s", output)
 	}
 
-	// Clean up the index file and restore os.Args.
-	os.Remove("sa.idx")
+	// Restore os.Args.
 	os.Args = origArgs
 }
 
@@ -212,3 +213,661 @@ func BenchmarkSAIS(b *testing.B) {
 		_ = SAISEntryPoint(encoded, alphabetSize)
 	}
 }
+
+// runCapture runs the application with the given arguments and returns what it
+// printed to standard output.
+func runCapture(t *testing.T, args ...string) string {
+	t.Helper()
+	origArgs := os.Args
+	origStdout := os.Stdout
+	defer func() {
+		os.Args = origArgs
+		os.Stdout = origStdout
+	}()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	os.Args = append([]string{"cmd"}, args...)
+	os.Stdout = w
+
+	// Drain the pipe concurrently so large outputs cannot block the application.
+	done := make(chan string)
+	go func() {
+		var outputBuilder strings.Builder
+		buf := make([]byte, 1024)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				outputBuilder.Write(buf[:n])
+			}
+			if err != nil {
+				break
+			}
+		}
+		done <- outputBuilder.String()
+	}()
+	main()
+	w.Close()
+	return <-done
+}
+
+// TestFASTAOutput checks that hits in a FASTA genome are reported by record name
+// and record-local offset rather than by line number.
+func TestFASTAOutput(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.fa"
+	genomeContent := ">chr1 test\nACGTAC\nGT\n>chr2\nTTGCA\n"
+	if err := os.WriteFile(genomeFile, []byte(genomeContent), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	patternFile := tempDir + "/patterns.txt"
+	if err := os.WriteFile(patternFile, []byte("CGT\nTGC\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+
+	output := runCapture(t, "-f", genomeFile, "-t", patternFile)
+	// The genome text is "ACGTACGT$TTGCA".
+	expected := []string{
+		`Pattern "CGT" found at positions: [(1, chr1:1) (5, chr1:5)]`,
+		`Pattern "TGC" found at positions: [(10, chr2:1)]`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(output, e) {
+			t.Errorf("Output does not contain %q. Got:\n%s", e, output)
+		}
+	}
+}
+
+// TestQueryCase checks that lowercase -s, -q, -t and -motif queries match a
+// soft-masked FASTA genome, as queries are upper-cased like the genome.
+func TestQueryCase(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.fa"
+	if err := os.WriteFile(genomeFile, []byte(">chr1\nGGacgtaa\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	indexFile := tempDir + "/sa.idx"
+	runCapture(t, "-m", "-f", genomeFile, "-i", indexFile)
+	queryFile := tempDir + "/queries.txt"
+	if err := os.WriteFile(queryFile, []byte("acgt\ncgtaa\n"), 0644); err != nil {
+		t.Fatalf("Failed to write query file: %v", err)
+	}
+
+	for _, args := range [][]string{{"-s", "acgt"}, {"-s", "acgy"}, {"-q", queryFile}, {"-motif", "ac[gc]t"}} {
+		output := runCapture(t, append(args, "-i", indexFile)...)
+		if strings.Contains(output, "not found") || !strings.Contains(output, "(2, chr1:2") {
+			t.Errorf("%v: expected a hit at 2, got output:\n%s", args, output)
+		}
+	}
+	output := runCapture(t, "-f", genomeFile, "-t", queryFile)
+	for _, e := range []string{`Pattern "ACGT" found at positions: [(2, chr1:2)]`, `Pattern "CGTAA" found at positions: [(3, chr1:3)]`} {
+		if !strings.Contains(output, e) {
+			t.Errorf("Output does not contain %q. Got:\n%s", e, output)
+		}
+	}
+}
+
+// TestFASTQPatternOutput runs a trie search with FASTQ reads as patterns and
+// checks that read IDs are carried into the report.
+func TestFASTQPatternOutput(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.txt"
+	if err := os.WriteFile(genomeFile, []byte("ACGT\nTGCA\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	readsFile := tempDir + "/reads.fq"
+	// read2 is trimmed from "TGCA" to "TGC" by the quality filter.
+	reads := "@read1\nACG\n+\nIII\n@read2\nTGCA\n+\nIII#\n"
+	if err := os.WriteFile(readsFile, []byte(reads), 0644); err != nil {
+		t.Fatalf("Failed to write reads file: %v", err)
+	}
+
+	output := runCapture(t, "-f", genomeFile, "-t", readsFile, "-trimq", "10")
+	expected := []string{
+		`Pattern "ACG" (read1) found at positions: [(0, line 0)]`,
+		`Pattern "TGC" (read2) found at positions: [(5, line 1)]`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(output, e) {
+			t.Errorf("Output does not contain %q. Got:\n%s", e, output)
+		}
+	}
+}
+
+// TestSearchFromIndexOnly searches without -f: the genome stored in the index is
+// used, so the original genome file is no longer needed.
+func TestSearchFromIndexOnly(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.fa"
+	if err := os.WriteFile(genomeFile, []byte(">chr1\nbanana\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	indexFile := tempDir + "/sa.idx"
+	runCapture(t, "-m", "-f", genomeFile, "-i", indexFile)
+	if err := os.Remove(genomeFile); err != nil {
+		t.Fatalf("Failed to remove genome file: %v", err)
+	}
+
+	output := runCapture(t, "-s", "ANA", "-i", indexFile)
+	if !strings.Contains(output, "(1, chr1:1)") || !strings.Contains(output, "(3, chr1:3)") {
+		t.Errorf("Expected hits for ANA in chr1, got output: %s", output)
+	}
+}
+
+// TestMultipleNamedIndexes builds two named indexes in one invocation and
+// queries both in another.
+func TestMultipleNamedIndexes(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeA := tempDir + "/a.fa"
+	genomeB := tempDir + "/b.fa"
+	if err := os.WriteFile(genomeA, []byte(">chrA\nGATTACA\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	if err := os.WriteFile(genomeB, []byte(">chrB\nTTACAGATTACA\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	indexA := "asmA=" + tempDir + "/a.idx"
+	indexB := tempDir + "/b.idx"
+
+	output := runCapture(t, "-m", "-f", genomeA, "-f", genomeB, "-i", indexA, "-i", indexB)
+	for _, path := range []string{tempDir + "/a.idx", tempDir + "/b.idx"} {
+		if !strings.Contains(output, "Index built and saved to "+path) {
+			t.Errorf("Expected index %s to be built, got output: %s", path, output)
+		}
+	}
+
+	output = runCapture(t, "-s", "TTACA", "-i", indexA, "-i", indexB)
+	expected := []string{
+		"Index asmA (" + tempDir + "/a.idx):",
+		"(2, chrA:2)",
+		"Index b (" + tempDir + "/b.idx):",
+		"(7, chrB:7)",
+		"(0, chrB:0)",
+	}
+	last := -1
+	for _, e := range expected {
+		i := strings.Index(output, e)
+		if i < last {
+			t.Errorf("Expected %q after the previous lines, got output: %s", e, output)
+		}
+		last = i
+	}
+}
+
+// TestFMBackendSearch builds a sampled FM-index with -backend fm and searches it.
+func TestFMBackendSearch(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.txt"
+	if err := os.WriteFile(genomeFile, []byte("banana\nbandana\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	indexFile := tempDir + "/fm.idx"
+	output := runCapture(t, "-m", "-backend", "fm", "-sample", "4", "-f", genomeFile, "-i", indexFile)
+	if !strings.Contains(output, "Building FM-index") {
+		t.Errorf("Expected the FM-index to be built, got output: %s", output)
+	}
+	// "banana$bandana" plus the sentinel has 15 suffixes, 4 at multiples of 4.
+	if !strings.Contains(output, "Sampled every 4 text positions: 4 of 15 suffix array values kept") {
+		t.Errorf("Expected sampling statistics, got output: %s", output)
+	}
+
+	output = runCapture(t, "-s", "ana", "-i", indexFile, "-f", genomeFile)
+	for _, e := range []string{"(1, 0)", "(3, 0)", "(11, 1)"} {
+		if !strings.Contains(output, e) {
+			t.Errorf("Expected hit %s for 'ana', got output: %s", e, output)
+		}
+	}
+}
+
+// TestStrandSearch searches both strands with -s and -t and checks that every
+// hit carries its strand.
+func TestStrandSearch(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.fa"
+	// "AAC" occurs forward at 0 and as its reverse complement "GTT" at 9.
+	if err := os.WriteFile(genomeFile, []byte(">chr1\nAACGAATTCGTT\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	indexFile := tempDir + "/sa.idx"
+	runCapture(t, "-m", "-f", genomeFile, "-i", indexFile)
+
+	output := runCapture(t, "-s", "AAC", "-strand", "both", "-i", indexFile)
+	for _, e := range []string{"(0, chr1:0, +)", "(9, chr1:9, -)"} {
+		if !strings.Contains(output, e) {
+			t.Errorf("Expected hit %s, got output: %s", e, output)
+		}
+	}
+
+	patternFile := tempDir + "/patterns.txt"
+	if err := os.WriteFile(patternFile, []byte("AAC\nGAATTC\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+	output = runCapture(t, "-f", genomeFile, "-t", patternFile, "-strand", "both")
+	expected := []string{
+		`Pattern "AAC" found at positions: [(0, chr1:0, +) (9, chr1:9, -)]`,
+		`Pattern "GAATTC" found at positions: [(3, chr1:3, +)]`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(output, e) {
+			t.Errorf("Output does not contain %q. Got:\n%s", e, output)
+		}
+	}
+}
+
+// TestMismatchSearch runs -s with -k and checks mismatch counts and offsets.
+func TestMismatchSearch(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.fa"
+	if err := os.WriteFile(genomeFile, []byte(">chr1\nGATTACA\n>chr2\nGATCACA\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	indexFile := tempDir + "/sa.idx"
+	runCapture(t, "-m", "-f", genomeFile, "-i", indexFile)
+
+	output := runCapture(t, "-s", "GATTACA", "-k", "1", "-i", indexFile)
+	expected := []string{
+		"Sequence found at positions (global position, DNA line, mismatches):",
+		"(0, chr1:0, mismatches 0 [])",
+		"(8, chr2:0, mismatches 1 [3])",
+	}
+	for _, e := range expected {
+		if !strings.Contains(output, e) {
+			t.Errorf("Output does not contain %q. Got:\n%s", e, output)
+		}
+	}
+}
+
+// TestEditDistanceSearch runs -s with -k and -indels and checks the reported
+// end, distance and CIGAR.
+func TestEditDistanceSearch(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.fa"
+	if err := os.WriteFile(genomeFile, []byte(">chr1\nGATTACA\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	indexFile := tempDir + "/sa.idx"
+	runCapture(t, "-m", "-f", genomeFile, "-i", indexFile)
+
+	output := runCapture(t, "-s", "GATACA", "-k", "1", "-indels", "-i", indexFile)
+	expected := "(0, chr1:0, end 7, distance 1, 2M1D4M)"
+	if !strings.Contains(output, expected) {
+		t.Errorf("Output does not contain %q. Got:\n%s", expected, output)
+	}
+}
+
+// TestDegenerateSearch uses IUPAC codes in -s and -t and checks that the
+// concrete sequence matched is reported.
+func TestDegenerateSearch(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.fa"
+	if err := os.WriteFile(genomeFile, []byte(">chr1\nACAGTTACTGT\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	indexFile := tempDir + "/sa.idx"
+	runCapture(t, "-m", "-f", genomeFile, "-i", indexFile)
+
+	output := runCapture(t, "-s", "ACNGT", "-i", indexFile)
+	for _, e := range []string{"(0, chr1:0, matched ACAGT)", "(6, chr1:6, matched ACTGT)"} {
+		if !strings.Contains(output, e) {
+			t.Errorf("Expected hit %s, got output: %s", e, output)
+		}
+	}
+
+	patternFile := tempDir + "/patterns.txt"
+	if err := os.WriteFile(patternFile, []byte("ACNGT\nTTR\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+	output = runCapture(t, "-f", genomeFile, "-t", patternFile)
+	expected := []string{
+		`Pattern "ACNGT" found at positions: [(0, chr1:0, matched ACAGT) (6, chr1:6, matched ACTGT)]`,
+		`Pattern "TTR" found at positions: [(4, chr1:4, matched TTA)]`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(output, e) {
+			t.Errorf("Output does not contain %q. Got:\n%s", e, output)
+		}
+	}
+
+	// "TN" and its reverse complement "NA" both match the palindromic "TA" at
+	// 5, which is reported on the forward strand only.
+	output = runCapture(t, "-s", "TN", "-strand", "both", "-i", indexFile)
+	for _, e := range []string{"(5, chr1:5, +, matched TA)", "(1, chr1:1, -, matched CA)"} {
+		if !strings.Contains(output, e) {
+			t.Errorf("Expected hit %s, got output: %s", e, output)
+		}
+	}
+	if strings.Contains(output, "(5, chr1:5, -") {
+		t.Errorf("Palindromic site reported on both strands: %s", output)
+	}
+	output = runCapture(t, "-s", "TN", "-strand", "both", "-count", "-i", indexFile)
+	if !strings.Contains(output, "found 4 times") {
+		t.Errorf("Expected 4 hits, got output: %s", output)
+	}
+}
+
+// TestMotifSearch runs -motif and checks the (position, line) report.
+func TestMotifSearch(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.txt"
+	if err := os.WriteFile(genomeFile, []byte("GCTATAAAAG\nCTATATATC\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	indexFile := tempDir + "/sa.idx"
+	runCapture(t, "-m", "-f", genomeFile, "-i", indexFile)
+
+	output := runCapture(t, "-motif", "TATA[AT]A[AT]", "-i", indexFile)
+	expected := "Sequence found at positions (global position, DNA line):\n(2, 0) (12, 1) \n"
+	if !strings.Contains(output, expected) {
+		t.Errorf("Output does not contain %q. Got:\n%s", expected, output)
+	}
+}
+
+// TestCountExistsAndLimit checks -count, -exists and -limit.
+func TestCountExistsAndLimit(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.txt"
+	if err := os.WriteFile(genomeFile, []byte("AAAAAAAA\nCCCC\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	indexFile := tempDir + "/sa.idx"
+	runCapture(t, "-m", "-f", genomeFile, "-i", indexFile)
+
+	if output := runCapture(t, "-s", "AAA", "-count", "-i", indexFile); !strings.Contains(output, "Sequence found 6 times.") {
+		t.Errorf("Expected 6 hits for AAA, got output: %s", output)
+	}
+	if output := runCapture(t, "-s", "GG", "-exists", "-i", indexFile); !strings.Contains(output, "Sequence not found.") {
+		t.Errorf("Expected GG not to exist, got output: %s", output)
+	}
+	output := runCapture(t, "-s", "AAA", "-limit", "2", "-i", indexFile)
+	if strings.Count(output, ", 0)") != 2 || !strings.Contains(output, "Showing 2 of 6 hits; raise -limit to see more.") {
+		t.Errorf("Expected 2 of 6 hits, got output: %s", output)
+	}
+}
+
+// TestBatchQueriesFromStdin reads plain queries from standard input with -q -
+// and searches them in sorted order, labelled by query number.
+func TestBatchQueriesFromStdin(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.txt"
+	if err := os.WriteFile(genomeFile, []byte("GATTACA\nTTACAG\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	indexFile := tempDir + "/sa.idx"
+	runCapture(t, "-m", "-f", genomeFile, "-i", indexFile)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	origStdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = origStdin }()
+	w.WriteString("TTACA\nGAT\nCCC\n")
+	w.Close()
+
+	output := runCapture(t, "-q", "-", "-sorted", "-i", indexFile)
+	expected := []string{
+		"Searching for query 3: CCC\nSequence not found.",
+		"Searching for query 2: GAT\nSequence found at positions (global position, DNA line):\n(0, 0)",
+		"Searching for query 1: TTACA\n",
+	}
+	last := -1
+	for _, e := range expected {
+		i := strings.Index(output, e)
+		if i <= last {
+			t.Errorf("Expected %q in sorted order, got output:\n%s", e, output)
+		}
+		last = i
+	}
+}
+
+// TestTrieSearchFromStdin streams the -t genome from standard input with -f -.
+func TestTrieSearchFromStdin(t *testing.T) {
+	tempDir := t.TempDir()
+	patternFile := tempDir + "/patterns.txt"
+	if err := os.WriteFile(patternFile, []byte("TTA\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	origStdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = origStdin }()
+	w.WriteString(">chr1\nGATTACA\n")
+	w.Close()
+
+	output := runCapture(t, "-t", patternFile, "-f", "-")
+	expected := `Pattern "TTA" found at positions: [(2, chr1:2)]`
+	if !strings.Contains(output, expected) {
+		t.Errorf("Output does not contain %q. Got:\n%s", expected, output)
+	}
+}
+
+// TestLocalCoordinates checks the record-local coordinates printed by -coords
+// for -s and -t hits.
+func TestLocalCoordinates(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.fa"
+	if err := os.WriteFile(genomeFile, []byte(">chr1\nACGT\n>chr2\nTGCAGCA\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	indexFile := tempDir + "/sa.idx"
+	runCapture(t, "-m", "-f", genomeFile, "-i", indexFile)
+
+	output := runCapture(t, "-s", "GCA", "-coords", "-i", indexFile)
+	for _, e := range []string{
+		"(global position, DNA line, record coordinates)",
+		"(6, chr2:1, [1, 4) 0-based, [2, 4] 1-based)",
+		"(9, chr2:4, [4, 7) 0-based, [5, 7] 1-based)",
+	} {
+		if !strings.Contains(output, e) {
+			t.Errorf("Output does not contain %q. Got:\n%s", e, output)
+		}
+	}
+
+	patternFile := tempDir + "/patterns.txt"
+	if err := os.WriteFile(patternFile, []byte("CGT\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+	output = runCapture(t, "-f", genomeFile, "-t", patternFile, "-coords")
+	expected := `Pattern "CGT" found at positions: [(1, chr1:1, [1, 4) 0-based, [2, 4] 1-based)]`
+	if !strings.Contains(output, expected) {
+		t.Errorf("Output does not contain %q. Got:\n%s", expected, output)
+	}
+}
+
+// TestJSONOutput checks the -format json and jsonl reports of -m, -s and -t.
+func TestJSONOutput(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.fa"
+	if err := os.WriteFile(genomeFile, []byte(">chr1\nACGT\n>chr2\nTGCAGCA\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	indexFile := tempDir + "/sa.idx"
+	var stats indexStats
+	if err := json.Unmarshal([]byte(runCapture(t, "-m", "-f", genomeFile, "-i", indexFile, "-format", "jsonl")), &stats); err != nil {
+		t.Fatalf("Failed to parse index stats: %v", err)
+	}
+	if stats.Records != 2 || stats.Length != 12 || stats.Path != indexFile {
+		t.Errorf("Unexpected index stats: %+v", stats)
+	}
+
+	var queries []jsonQuery
+	if err := json.Unmarshal([]byte(runCapture(t, "-s", "GCA", "-i", indexFile, "-format", "json")), &queries); err != nil {
+		t.Fatalf("Failed to parse query results: %v", err)
+	}
+	if len(queries) != 1 || queries[0].Query != "GCA" || queries[0].Count != 2 || len(queries[0].Hits) != 2 {
+		t.Fatalf("Unexpected query results: %+v", queries)
+	}
+	found := false
+	for _, hit := range queries[0].Hits {
+		found = found || hit.Record == "chr2" && hit.Position == 6 && hit.Start == 1 && hit.End == 4 && hit.Strand == "+" && hit.CIGAR == "3M"
+	}
+	if !found {
+		t.Errorf("Hit at chr2:1 missing: %+v", queries[0].Hits)
+	}
+
+	patternFile := tempDir + "/patterns.txt"
+	if err := os.WriteFile(patternFile, []byte("CGT\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+	var pattern jsonPattern
+	if err := json.Unmarshal([]byte(runCapture(t, "-f", genomeFile, "-t", patternFile, "-format", "jsonl")), &pattern); err != nil {
+		t.Fatalf("Failed to parse pattern results: %v", err)
+	}
+	if pattern.Pattern != "CGT" || pattern.Count != 1 || pattern.Hits[0].Record != "chr1" || pattern.Hits[0].Start != 1 {
+		t.Errorf("Unexpected pattern results: %+v", pattern)
+	}
+
+	// Queries and patterns not found report the same outcome keys.
+	if err := os.WriteFile(patternFile, []byte("GGG\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+	for _, args := range [][]string{{"-s", "GGG", "-i", indexFile}, {"-f", genomeFile, "-t", patternFile}} {
+		var obj map[string]json.RawMessage
+		output := runCapture(t, append(args, "-format", "jsonl")...)
+		if err := json.Unmarshal([]byte(output), &obj); err != nil {
+			t.Fatalf("Failed to parse %v results: %v", args, err)
+		}
+		for key, expected := range map[string]string{"count": "0", "found": "false", "hits": "[]"} {
+			if string(obj[key]) != expected {
+				t.Errorf("%v: %q is %s, expected %s", args, key, obj[key], expected)
+			}
+		}
+	}
+}
+
+// TestFeatureOutput checks the BED6 and GFF3 features written for -s and -t
+// hits, named after their records.
+func TestFeatureOutput(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.fa"
+	if err := os.WriteFile(genomeFile, []byte(">chr1\nACGT\n>chr2\nTGCAGCA\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	indexFile := tempDir + "/sa.idx"
+	runCapture(t, "-m", "-f", genomeFile, "-i", indexFile)
+
+	output := runCapture(t, "-s", "GCA", "-strand", "both", "-i", indexFile, "-format", "bed")
+	for _, e := range []string{"chr2\t1\t4\tGCA\t0\t+\n", "chr2\t4\t7\tGCA\t0\t+\n", "chr2\t0\t3\tGCA\t0\t-\n"} {
+		if !strings.Contains(output, e) {
+			t.Errorf("BED output does not contain %q. Got:\n%s", e, output)
+		}
+	}
+
+	patternFile := tempDir + "/patterns.txt"
+	if err := os.WriteFile(patternFile, []byte("CGT\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+	output = runCapture(t, "-f", genomeFile, "-t", patternFile, "-format", "gff3")
+	expected := "##gff-version 3\nchr1\tdnatools\tnucleotide_match\t2\t4\t.\t+\t.\tName=CGT\n"
+	if output != expected {
+		t.Errorf("Expected GFF3 output %q, got %q", expected, output)
+	}
+}
+
+// TestSAMOutput checks the SAM header and alignment records written for -q
+// queries, including secondary, reverse-strand and unmapped ones. The
+// palindromic TGCA at chr2:1 is reported on the forward strand only.
+func TestSAMOutput(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.fa"
+	if err := os.WriteFile(genomeFile, []byte(">chr1\nACGT\n>chr2\nTGCAGCA\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	indexFile := tempDir + "/sa.idx"
+	runCapture(t, "-m", "-f", genomeFile, "-i", indexFile)
+	queryFile := tempDir + "/reads.fa"
+	if err := os.WriteFile(queryFile, []byte(">r1\nTGCC\n>r2\nGGGG\n"), 0644); err != nil {
+		t.Fatalf("Failed to write query file: %v", err)
+	}
+
+	output := runCapture(t, "-q", queryFile, "-k", "1", "-strand", "both", "-i", indexFile, "-format", "sam")
+	expected := []string{
+		"@HD\tVN:1.6\tSO:unsorted\n@SQ\tSN:chr1\tLN:4\n@SQ\tSN:chr2\tLN:7\n",
+		"r1\t0\tchr2\t1\t255\t4M\t*\t0\t0\tTGCC\t*\tNM:i:1\n",
+		"r1\t272\tchr2\t4\t255\t4M\t*\t0\t0\tGGCA\t*\tNM:i:1\n",
+		"r2\t4\t*\t0\t0\t*\t*\t0\t0\tGGGG\t*\n",
+	}
+	if !strings.HasPrefix(output, expected[0]) {
+		t.Errorf("Output does not start with the SAM header. Got:\n%s", output)
+	}
+	for _, e := range expected[1:] {
+		if !strings.Contains(output, e) {
+			t.Errorf("Output does not contain %q. Got:\n%s", e, output)
+		}
+	}
+	if strings.Contains(output, "r1\t272\tchr2\t1\t") {
+		t.Errorf("Palindromic site reported on both strands. Got:\n%s", output)
+	}
+
+	// NM counts a degenerate code as a difference from the reference even
+	// where it matches, and an unmapped motif has no SEQ.
+	output = runCapture(t, "-s", "TGNAG", "-k", "1", "-indels", "-i", indexFile, "-format", "sam")
+	if !strings.Contains(output, "TGNAG\t0\tchr2\t1\t255\t5M\t*\t0\t0\tTGNAG\t*\tNM:i:1\n") {
+		t.Errorf("Degenerate hit lacks its literal NM. Got:\n%s", output)
+	}
+	output = runCapture(t, "-s", "TGNCAG", "-k", "1", "-indels", "-i", indexFile, "-format", "sam")
+	for _, e := range []string{"TGNCAG\t0\tchr2\t1\t255\t1M1I4M\t*\t0\t0\tTGNCAG\t*\tNM:i:2\n"} {
+		if !strings.Contains(output, e) {
+			t.Errorf("Output does not contain %q. Got:\n%s", e, output)
+		}
+	}
+	output = runCapture(t, "-s", "GCN", "-i", indexFile, "-format", "sam")
+	if !strings.Contains(output, "GCN\t0\tchr2\t5\t255\t3M\t*\t0\t0\tGCN\t*\tNM:i:1\n") {
+		t.Errorf("Degenerate exact hit lacks its literal NM. Got:\n%s", output)
+	}
+	output = runCapture(t, "-motif", "GGGG", "-i", indexFile, "-format", "sam")
+	if !strings.HasSuffix(output, "GGGG\t4\t*\t0\t0\t*\t*\t0\t0\t*\t*\n") {
+		t.Errorf("Unmapped motif record should have no SEQ. Got:\n%s", output)
+	}
+
+	// Empty records are no SAM references, and -m writes @HD before its
+	// comments.
+	if err := os.WriteFile(genomeFile, []byte(">e1\n>chr1\nACGT\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	output = runCapture(t, "-m", "-f", genomeFile, "-i", indexFile, "-format", "sam")
+	if !strings.HasPrefix(output, "@HD\tVN:1.6\tSO:unsorted\n@CO\tindex sa built") {
+		t.Errorf("Index build output does not start with @HD. Got:\n%s", output)
+	}
+	output = runCapture(t, "-s", "CG", "-i", indexFile, "-format", "sam")
+	if strings.Contains(output, "SN:e1") || !strings.Contains(output, "@SQ\tSN:chr1\tLN:4\n") {
+		t.Errorf("Header should list chr1 only. Got:\n%s", output)
+	}
+}
+
+// TestPatternOrder checks that -t reports every pattern, found or not, in
+// pattern file order or, with -order position, by first hit.
+func TestPatternOrder(t *testing.T) {
+	tempDir := t.TempDir()
+	genomeFile := tempDir + "/genome.txt"
+	if err := os.WriteFile(genomeFile, []byte("ACGT\nTGCA\n"), 0644); err != nil {
+		t.Fatalf("Failed to write genome file: %v", err)
+	}
+	patternFile := tempDir + "/patterns.txt"
+	if err := os.WriteFile(patternFile, []byte("TGC\nGGG\nACG\nTGC\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pattern file: %v", err)
+	}
+	tgc := `Pattern "TGC" found at positions: [(5, line 1)]` + "\n"
+	ggg := `Pattern "GGG" not found.` + "\n"
+	acg := `Pattern "ACG" found at positions: [(0, line 0)]` + "\n"
+	for _, tc := range []struct {
+		order, expected string
+	}{
+		{"input", tgc + ggg + acg},
+		{"position", acg + tgc + ggg},
+	} {
+		// Repeat each run to catch orders that vary between runs.
+		for range 3 {
+			if output := runCapture(t, "-f", genomeFile, "-t", patternFile, "-order", tc.order); output != tc.expected {
+				t.Errorf("-order %s: expected %q, got %q", tc.order, tc.expected, output)
+			}
+		}
+	}
+}
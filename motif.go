@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxMotifRepeat bounds the repeat counts of a motif element.
+const maxMotifRepeat = 1000
+
+// motifElem is one position class of a motif, repeated min to max times.
+type motifElem struct {
+	set      [256]bool // text bytes the element matches
+	min, max int
+}
+
+// motif is a structured pattern such as "TATA[AT]A[AT]" or "CAG.{2,5}CTG",
+// matched left to right.
+type motif []motifElem
+
+// parseMotif parses a motif. Its elements are
+//
+//	A, C, R, N, ...  a base or degenerate IUPAC code
+//	[ACG]            any of the listed bases or codes
+//	[^ACG]           any base but the listed ones
+//	. or x           any base (a gap position)
+//
+// each optionally followed by a repeat count {n} or {m,n}, also written in
+// PROSITE style as (n) or (m,n), so gap ranges read ".{2,5}" or "x(2,5)".
+// PROSITE '-' separators between elements are ignored.
+func parseMotif(s string) (motif, error) {
+	var m motif
+	for i := 0; i < len(s); {
+		var el motifElem
+		switch c := s[i]; {
+		case c == '-':
+			i++
+			continue
+		case c == '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("motif %q: unterminated class at offset %d", s, i)
+			}
+			class := s[i+1 : i+end]
+			negate := strings.HasPrefix(class, "^")
+			class = strings.TrimPrefix(class, "^")
+			if class == "" {
+				return nil, fmt.Errorf("motif %q: empty class at offset %d", s, i)
+			}
+			var listed [256]bool
+			for j := 0; j < len(class); j++ {
+				if !isMotifBase(class[j]) {
+					return nil, fmt.Errorf("motif %q: unexpected %q in class", s, class[j])
+				}
+				addBases(&listed, class[j])
+			}
+			for b := range el.set {
+				el.set[b] = listed[b] != negate && b != '$'
+			}
+			i += end + 1
+		case c == '.' || c == 'x' || c == 'X':
+			for b := range el.set {
+				el.set[b] = b != '$'
+			}
+			i++
+		case isMotifBase(c):
+			addBases(&el.set, c)
+			i++
+		default:
+			return nil, fmt.Errorf("motif %q: unexpected %q at offset %d", s, c, i)
+		}
+		el.min, el.max = 1, 1
+		if i < len(s) && (s[i] == '{' || s[i] == '(') {
+			close := byte('}')
+			if s[i] == '(' {
+				close = ')'
+			}
+			end := strings.IndexByte(s[i:], close)
+			if end < 0 {
+				return nil, fmt.Errorf("motif %q: unterminated repeat at offset %d", s, i)
+			}
+			var err error
+			if el.min, el.max, err = parseRepeat(s[i+1 : i+end]); err != nil {
+				return nil, fmt.Errorf("motif %q: %v", s, err)
+			}
+			i += end + 1
+		}
+		m = append(m, el)
+	}
+	if !slices.ContainsFunc(m, func(el motifElem) bool { return el.min > 0 }) {
+		return nil, fmt.Errorf("motif %q matches the empty sequence", s)
+	}
+	return m, nil
+}
+
+// isMotifBase reports whether c may stand for itself in a motif.
+func isMotifBase(c byte) bool {
+	return 'A' <= c && c <= 'Z' && c != 'X' || 'a' <= c && c <= 'z' && c != 'x'
+}
+
+// addBases adds c and, for a degenerate code, the bases it stands for to set.
+func addBases(set *[256]bool, c byte) {
+	set[c] = true
+	for i := 0; i < len(iupacBases[c]); i++ {
+		set[iupacBases[c][i]] = true
+	}
+}
+
+// parseRepeat parses the "n" or "m,n" inside a repeat count.
+func parseRepeat(s string) (min, max int, err error) {
+	lo, hi, ranged := strings.Cut(s, ",")
+	if min, err = strconv.Atoi(strings.TrimSpace(lo)); err != nil {
+		return 0, 0, fmt.Errorf("bad repeat count %q", s)
+	}
+	max = min
+	if ranged {
+		if max, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+			return 0, 0, fmt.Errorf("bad repeat count %q", s)
+		}
+	}
+	if min < 0 || max < min || max > maxMotifRepeat {
+		return 0, 0, fmt.Errorf("repeat count %q must satisfy 0 <= m <= n <= %d", s, maxMotifRepeat)
+	}
+	return min, max, nil
+}
+
+// reverseComplement returns the motif matching the reverse complement of
+// every sequence m matches.
+func (m motif) reverseComplement() motif {
+	rc := make(motif, len(m))
+	for i, el := range m {
+		var set [256]bool
+		for b, ok := range el.set {
+			if ok {
+				set[complements[b]] = true
+			}
+		}
+		rc[len(m)-1-i] = motifElem{set, el.min, el.max}
+	}
+	return rc
+}
+
+// orientedMotif is one orientation of a motif to search for: the motif as it
+// matches on the forward strand and the strand it reports.
+type orientedMotif struct {
+	elems  motif
+	Strand byte
+}
+
+// orientations returns the orientations of m selected by strand, forward
+// first. A motif that is its own reverse complement is searched once.
+func (m motif) orientations(strand string) []orientedMotif {
+	rc := m.reverseComplement()
+	switch {
+	case strand == strandReverse:
+		return []orientedMotif{{rc, '-'}}
+	case strand == strandBoth && !slices.Equal(rc, m):
+		return []orientedMotif{{m, '+'}, {rc, '-'}}
+	}
+	return []orientedMotif{{m, '+'}}
+}
+
+// fixedLength reports whether every match of m has the same length, so that
+// m matches at most once per start position.
+func (m motif) fixedLength() bool {
+	return !slices.ContainsFunc(m, func(el motifElem) bool { return el.min != el.max })
+}
+
+// motifIntervals narrows suffix array intervals one text base at a time: each
+// branch either extends the current element of m by a base it matches, while
+// below its maximum count, or moves on to the next element once the minimum
+// count is reached. visit receives the rows [lo, hi) of every branch that
+// completes the motif, with the text matched; the walk stops early once visit
+// returns false.
+func motifIntervals(idx *Index, m motif, visit func(lo, hi int, matched string) bool) {
+	alphabet := idx.textAlphabet()
+	// The FM-index extends matches backward, so it walks the elements from
+	// the last.
+	if idx.fm != nil {
+		m = slices.Clone(m)
+		slices.Reverse(m)
+	}
+	var path []byte // the text walked
+	var walk func(lo, hi, e, count int) bool
+	walk = func(lo, hi, e, count int) bool {
+		if e == len(m) {
+			if len(path) == 0 {
+				return true
+			}
+			matched := slices.Clone(path)
+			if idx.fm != nil {
+				slices.Reverse(matched)
+			}
+			return visit(lo, hi, string(matched))
+		}
+		el := m[e]
+		if count >= el.min && !walk(lo, hi, e+1, 0) {
+			return false
+		}
+		if count == el.max {
+			return true
+		}
+		for _, c := range alphabet {
+			if !el.set[c] {
+				continue
+			}
+			if nlo, nhi := idx.extend(lo, hi, len(path), c); nlo < nhi {
+				path = append(path, c)
+				more := walk(nlo, nhi, e, count+1)
+				path = path[:len(path)-1]
+				if !more {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	walk(0, idx.Len(), 0, 0)
+}
+
+// searchMotif finds the occurrences of every orientation of m selected by
+// strand through motifIntervals. Every start position is reported once per
+// strand, with its shortest match, in position order. A reverse-strand match
+// on palindromic text is left to the forward strand, which matches there too.
+func searchMotif(idx *Index, m motif, strand string) []searchHit {
+	var hits []searchHit
+	for _, o := range m.orientations(strand) {
+		best := make(map[int]searchHit)
+		motifIntervals(idx, o.elems, func(lo, hi int, matched string) bool {
+			if o.Strand == '-' && strand == strandBoth && isPalindromic(matched) {
+				return true
+			}
+			for i := lo; i < hi; i++ {
+				entry := idx.Entry(i)
+				if prev, ok := best[entry.Pos]; !ok || entry.Pos+len(matched) < prev.End {
+					best[entry.Pos] = searchHit{SuffixEntry: entry, End: entry.Pos + len(matched), Strand: o.Strand, CIGAR: fmt.Sprintf("%dM", len(matched)), Matched: matched}
+				}
+			}
+			return true
+		})
+		start := len(hits)
+		for _, hit := range best {
+			hits = append(hits, hit)
+		}
+		found := hits[start:]
+		sort.Slice(found, func(i, j int) bool { return found[i].Pos < found[j].Pos })
+	}
+	return hits
+}
+
+// countMotif returns the number of hits searchMotif would find or, if exists
+// is set, 1 if there is any. A fixed-length motif matches each start position
+// at most once per strand, so its count adds up interval sizes without
+// locating them, as does every existence check, which stops at the first
+// match. Other motifs are located to count each start position once.
+func countMotif(idx *Index, m motif, strand string, exists bool) int {
+	if !exists && !m.fixedLength() {
+		return len(searchMotif(idx, m, strand))
+	}
+	count := 0
+	for _, o := range m.orientations(strand) {
+		motifIntervals(idx, o.elems, func(lo, hi int, matched string) bool {
+			if o.Strand == '-' && strand == strandBoth && isPalindromic(matched) {
+				return true
+			}
+			count += hi - lo
+			return !exists
+		})
+		if exists && count > 0 {
+			return 1
+		}
+	}
+	return count
+}
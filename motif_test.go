@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+func TestParseMotifErrors(t *testing.T) {
+	for _, s := range []string{"TA[AT", "A{2", "A{3,1}", "[]", "A?", "N{0,2}", ""} {
+		if _, err := parseMotif(s); err == nil {
+			t.Errorf("parseMotif(%q): expected an error", s)
+		}
+	}
+}
+
+func TestSearchMotifMatchesRegexp(t *testing.T) {
+	// Each motif with an equivalent regular expression over the random
+	// genome's bases ACGTN.
+	motifs := map[string]string{
+		"TATA[AT]A[AT]":  "TATA[AT]A[AT]",
+		"CA.{1,3}G":      "CA[ACGTN]{1,3}G",
+		"C-x(2)-[^A]-G":  "C[ACGTN]{2}[CGTN]G",
+		"AN{2}T":         "A[ACGTN]{2}T",
+		"G{2,3}R(0,2)CC": "G{2,3}[AGR]{0,2}CC",
+	}
+	rng := rand.New(rand.NewSource(6))
+	g := randomGenome(rng, 3, 400)
+	for _, backend := range []string{backendSA, backendFM} {
+		idx := buildIndex(g, indexOptions{Backend: backend})
+		for s, expr := range motifs {
+			m, err := parseMotif(s)
+			if err != nil {
+				t.Fatalf("parseMotif(%q): %v", s, err)
+			}
+			re := regexp.MustCompile("^(?:" + expr + ")")
+			var expected []int
+			for p := range g.Text {
+				if re.MatchString(g.Text[p:]) {
+					expected = append(expected, p)
+				}
+			}
+			var got []int
+			for _, hit := range searchMotif(idx, m, strandForward) {
+				if !re.MatchString(g.Text[hit.Pos:hit.End]) || hit.Matched != g.Text[hit.Pos:hit.End] {
+					t.Errorf("%s: motif %q hit %q does not match", backend, s, g.Text[hit.Pos:hit.End])
+				}
+				got = append(got, hit.Pos)
+			}
+			if !sort.IntsAreSorted(got) {
+				t.Errorf("%s: motif %q hits out of order: %v", backend, s, got)
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("%s: motif %q found %v, expected %v", backend, s, got, expected)
+			}
+		}
+	}
+}
+
+func TestSearchMotifReverseStrand(t *testing.T) {
+	// "TATA[AT]" on the reverse strand is "[AT]TATA" on the forward one.
+	g := &Genome{Text: "GGATATAAGTTATACC", Records: []Record{{Start: 0, Len: 16}}}
+	m, _ := parseMotif("TATA[AT]")
+	var got []string
+	for _, hit := range searchMotif(buildIndex(g, indexOptions{}), m, strandBoth) {
+		got = append(got, string(hit.Strand)+g.Text[hit.Pos:hit.End])
+	}
+	expected := []string{"+TATAA", "-ATATA", "-TTATA"}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Hits: got %v, expected %v", got, expected)
+	}
+}
+
+func TestCountMotif(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	g := randomGenome(rng, 3, 400)
+	for _, backend := range []string{backendSA, backendFM} {
+		idx := buildIndex(g, indexOptions{Backend: backend})
+		for _, s := range []string{"TATA[AT]", "AN", "CA.{1,3}G", "GATC", "GGGGGGGGGG"} {
+			m, _ := parseMotif(s)
+			for _, strand := range []string{strandForward, strandReverse, strandBoth} {
+				hits := len(searchMotif(idx, m, strand))
+				if got := countMotif(idx, m, strand, false); got != hits {
+					t.Errorf("%s: countMotif(%q, %s) = %d, expected %d", backend, s, strand, got, hits)
+				}
+				if got, expected := countMotif(idx, m, strand, true), min(hits, 1); got != expected {
+					t.Errorf("%s: countMotif(%q, %s, exists) = %d, expected %d", backend, s, strand, got, expected)
+				}
+			}
+		}
+	}
+}
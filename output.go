@@ -0,0 +1,531 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Output formats for -format.
+const (
+	formatText  = "text"
+	formatJSON  = "json"
+	formatJSONL = "jsonl"
+	formatBED   = "bed"
+	formatGFF3  = "gff3"
+	formatSAM   = "sam"
+)
+
+// indexStats describes an index built by -m.
+type indexStats struct {
+	Index      string `json:"index"`
+	Path       string `json:"path"`
+	Genome     string `json:"genome"`
+	Backend    string `json:"backend"`
+	Records    int    `json:"records"`
+	Length     int    `json:"length"`
+	Entries    int    `json:"entries"`
+	SampleRate int    `json:"sample_rate,omitempty"`
+	Samples    int    `json:"samples,omitempty"`
+}
+
+// queryResult is the outcome of one -s, -q or -motif query against one index.
+type queryResult struct {
+	Index  indexSpec
+	Genome *Genome // the record table of the index
+	ID     string  // read name or query number; empty for -s and -motif
+	Query  string
+	Motif  bool
+	Hits   []searchHit // none in -count and -exists modes
+	Total  int         // hits found before -limit; for -exists motifs, 1 if any
+}
+
+// patternResult is the outcome of one -t pattern against one genome file.
+type patternResult struct {
+	Genome  string
+	Pattern string
+	IDs     []string
+	Hits    []trieHit
+}
+
+// reporter writes the results of runApp in the format chosen by -format.
+type reporter interface {
+	indexStarted(backend string)
+	indexBuilt(s indexStats)
+	queryDone(r queryResult)
+	patternsDone(genome string, results []patternResult)
+	close()
+}
+
+// reportOptions holds what a reporter needs to know about the run.
+type reportOptions struct {
+	Search      searchOptions
+	Coords      bool // text: print record-local coordinates
+	CountOnly   bool
+	Exists      bool
+	MultiIndex  bool // several -i indexes are searched
+	MultiGenome bool // several -f genomes are scanned by -t
+}
+
+// newReporter returns the reporter for format.
+func newReporter(format string, opts reportOptions) (reporter, error) {
+	switch format {
+	case formatText:
+		return &textReporter{opts: opts}, nil
+	case formatJSON, formatJSONL:
+		return &jsonReporter{opts: opts, lines: format == formatJSONL}, nil
+	case formatBED, formatGFF3:
+		if opts.CountOnly || opts.Exists {
+			return nil, fmt.Errorf("-count and -exists report no hits to write as %s", format)
+		}
+		return &featureReporter{opts: opts, gff: format == formatGFF3}, nil
+	case formatSAM:
+		if opts.CountOnly || opts.Exists {
+			return nil, fmt.Errorf("-count and -exists report no hits to write as %s", format)
+		}
+		if opts.MultiIndex {
+			return nil, fmt.Errorf("%s output holds the records of one index; search the indexes one at a time", format)
+		}
+		return &samReporter{opts: opts}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q (use %s, %s, %s, %s, %s or %s)", format, formatText, formatJSON, formatJSONL, formatBED, formatGFF3, formatSAM)
+}
+
+// textReporter prints the human-readable report.
+type textReporter struct {
+	opts      reportOptions
+	lastIndex indexSpec
+}
+
+func (t *textReporter) indexStarted(backend string) {
+	if backend == backendFM {
+		fmt.Println("Building FM-index using SAIS algorithm...")
+	} else {
+		fmt.Println("Building suffix array index using SAIS algorithm...")
+	}
+}
+
+func (t *textReporter) indexBuilt(s indexStats) {
+	if s.Backend == backendFM {
+		fmt.Printf("Sampled every %d text positions: %d of %d suffix array values kept\n", s.SampleRate, s.Samples, s.Entries)
+	}
+	fmt.Printf("Index built and saved to %s\n", s.Path)
+}
+
+func (t *textReporter) queryDone(r queryResult) {
+	if t.opts.MultiIndex && r.Index != t.lastIndex {
+		fmt.Printf("Index %s (%s):\n", r.Index.Name, r.Index.Path)
+		t.lastIndex = r.Index
+	}
+	switch {
+	case r.Motif:
+		fmt.Printf("Searching for motif: %s\n", r.Query)
+	case r.ID != "":
+		fmt.Printf("Searching for query %s: %s\n", r.ID, r.Query)
+	default:
+		fmt.Printf("Searching for sequence: %s\n", r.Query)
+	}
+	if t.opts.CountOnly || t.opts.Exists {
+		printCount(r.Total, t.opts.Exists)
+		return
+	}
+	query := r.Query
+	if r.Motif {
+		// Motif hits are reported like plain -s hits.
+		query = ""
+	}
+	printSearchResults(r.Genome, query, r.Hits, t.opts.Search, t.opts.Coords)
+	printLimited(len(r.Hits), r.Total)
+}
+
+func (t *textReporter) patternsDone(genome string, results []patternResult) {
+	if t.opts.MultiGenome {
+		fmt.Printf("Genome %s:\n", genome)
+	}
+	printTrieResults(results, t.opts.Search.Strand != strandForward, t.opts.Coords)
+}
+
+func (t *textReporter) close() {}
+
+// jsonHit is the JSON form of a hit. Positions are global text positions;
+// start and end are 0-based half-open offsets within the record.
+type jsonHit struct {
+	Record      string `json:"record"`
+	RecordIndex int    `json:"record_index"`
+	Position    int    `json:"position"`
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	Strand      string `json:"strand"`
+	Distance    int    `json:"distance"`
+	CIGAR       string `json:"cigar"`
+	Mismatches  []int  `json:"mismatches,omitempty"`
+	Matched     string `json:"matched"`
+}
+
+// jsonMatches holds the fields every query and pattern object ends with, so
+// both kinds report their outcome under the same keys. Count is the number of
+// hits before -limit; hits is always written, and empty in -count and -exists
+// modes.
+type jsonMatches struct {
+	Count int       `json:"count"`
+	Found bool      `json:"found"`
+	Hits  []jsonHit `json:"hits"`
+}
+
+// newJSONMatches returns the outcome of a search finding count hits, with an
+// empty hit list for the caller to fill.
+func newJSONMatches(count int) jsonMatches {
+	return jsonMatches{Count: count, Found: count > 0, Hits: []jsonHit{}}
+}
+
+// jsonQuery is the JSON form of a queryResult.
+type jsonQuery struct {
+	Index string `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Query string `json:"query,omitempty"`
+	Motif string `json:"motif,omitempty"`
+	jsonMatches
+}
+
+// jsonPattern is the JSON form of a patternResult.
+type jsonPattern struct {
+	Genome  string   `json:"genome"`
+	Pattern string   `json:"pattern"`
+	IDs     []string `json:"ids,omitempty"`
+	jsonMatches
+}
+
+// jsonReporter writes every index built, query and pattern as one JSON object:
+// all of them in one array, or one per line for JSON Lines, as they complete.
+type jsonReporter struct {
+	opts    reportOptions
+	lines   bool
+	written int
+}
+
+func (j *jsonReporter) emit(v any) {
+	if j.lines {
+		b, _ := json.Marshal(v)
+		os.Stdout.Write(append(b, '\n'))
+		return
+	}
+	b, _ := json.MarshalIndent(v, "  ", "  ")
+	if j.written == 0 {
+		fmt.Print("[\n  ")
+	} else {
+		fmt.Print(",\n  ")
+	}
+	os.Stdout.Write(b)
+	j.written++
+}
+
+func (j *jsonReporter) indexStarted(string) {}
+
+func (j *jsonReporter) indexBuilt(s indexStats) {
+	j.emit(s)
+}
+
+func (j *jsonReporter) queryDone(r queryResult) {
+	q := jsonQuery{Index: r.Index.Name, ID: r.ID, jsonMatches: newJSONMatches(r.Total)}
+	if r.Motif {
+		q.Motif = r.Query
+	} else {
+		q.Query = r.Query
+	}
+	for _, hit := range r.Hits {
+		q.Hits = append(q.Hits, searchHitJSON(r.Genome, hit))
+	}
+	j.emit(q)
+}
+
+func (j *jsonReporter) patternsDone(genome string, results []patternResult) {
+	for _, r := range results {
+		p := jsonPattern{Genome: genome, Pattern: r.Pattern, IDs: r.IDs, jsonMatches: newJSONMatches(len(r.Hits))}
+		for _, hit := range r.Hits {
+			p.Hits = append(p.Hits, trieHitJSON(hit))
+		}
+		j.emit(p)
+	}
+}
+
+func (j *jsonReporter) close() {
+	switch {
+	case j.lines:
+	case j.written == 0:
+		fmt.Println("[]")
+	default:
+		fmt.Println("\n]")
+	}
+}
+
+// searchHitJSON converts a suffix array hit, locating it in g's records.
+func searchHitJSON(g *Genome, hit searchHit) jsonHit {
+	h := jsonHit{
+		RecordIndex: hit.Line,
+		Position:    hit.Pos,
+		Strand:      string(hit.Strand),
+		Distance:    hit.Distance,
+		CIGAR:       hit.CIGAR,
+		Mismatches:  hit.Mismatches,
+		Matched:     hit.Matched,
+	}
+	if start, end, ok := g.localSpan(hit.Line, hit.Pos, hit.End); ok {
+		h.Record, h.Start, h.End = g.Records[hit.Line].Name, start, end
+	}
+	return h
+}
+
+// trieHitJSON converts a streamed trie hit.
+func trieHitJSON(hit trieHit) jsonHit {
+	return jsonHit{
+		Record:      hit.Name,
+		RecordIndex: hit.Record,
+		Position:    hit.Pos,
+		Start:       hit.Offset,
+		End:         hit.Offset + len(hit.Matched),
+		Strand:      string(hit.Strand),
+		CIGAR:       fmt.Sprintf("%dM", len(hit.Matched)),
+		Matched:     hit.Matched,
+	}
+}
+
+// feature is a hit located on a record, as written to BED and GFF3.
+type feature struct {
+	Seqid      string // record name, or record index for unnamed records
+	Start, End int    // 0-based half-open offsets within the record
+	Name       string
+	Distance   int
+	Strand     byte
+}
+
+// featureReporter writes hits as BED6 lines or GFF3 features, one per hit, on
+// the forward-strand span of the record they fall in. Builds and changes of
+// index or genome are noted in '#' comment lines, which both formats allow.
+type featureReporter struct {
+	opts      reportOptions
+	gff       bool
+	started   bool
+	lastIndex indexSpec
+}
+
+// header writes the GFF3 version directive before anything else.
+func (f *featureReporter) header() {
+	if f.gff && !f.started {
+		fmt.Println("##gff-version 3")
+	}
+	f.started = true
+}
+
+func (f *featureReporter) indexStarted(string) {}
+
+func (f *featureReporter) indexBuilt(s indexStats) {
+	f.header()
+	fmt.Printf("# index %s built from %s (%d records, %d bases) and saved to %s\n", s.Index, s.Genome, s.Records, s.Length, s.Path)
+}
+
+func (f *featureReporter) queryDone(r queryResult) {
+	f.header()
+	if f.opts.MultiIndex && r.Index != f.lastIndex {
+		fmt.Printf("# index %s (%s)\n", r.Index.Name, r.Index.Path)
+		f.lastIndex = r.Index
+	}
+	name := r.Query
+	if r.ID != "" {
+		name = r.ID
+	}
+	for _, hit := range r.Hits {
+		start, end, ok := r.Genome.localSpan(hit.Line, hit.Pos, hit.End)
+		if !ok {
+			continue
+		}
+		f.write(feature{recordName(r.Genome.Records[hit.Line].Name, hit.Line), start, end, name, hit.Distance, hit.Strand})
+	}
+}
+
+func (f *featureReporter) patternsDone(genome string, results []patternResult) {
+	f.header()
+	if f.opts.MultiGenome {
+		fmt.Printf("# genome %s\n", genome)
+	}
+	for _, r := range results {
+		name := r.Pattern
+		if len(r.IDs) > 0 {
+			name = strings.Join(r.IDs, ",")
+		}
+		for _, hit := range r.Hits {
+			f.write(feature{recordName(hit.Name, hit.Record), hit.Offset, hit.Offset + len(hit.Matched), name, 0, hit.Strand})
+		}
+	}
+}
+
+func (f *featureReporter) close() {}
+
+// write prints one feature. BED scores are the hit distance; GFF3 scores are
+// left out (".") for exact searches.
+func (f *featureReporter) write(ft feature) {
+	if !f.gff {
+		fmt.Printf("%s\t%d\t%d\t%s\t%d\t%c\n", ft.Seqid, ft.Start, ft.End, ft.Name, ft.Distance, ft.Strand)
+		return
+	}
+	score := "."
+	if f.opts.Search.MaxDist > 0 {
+		score = strconv.Itoa(ft.Distance)
+	}
+	fmt.Printf("%s\tdnatools\tnucleotide_match\t%d\t%d\t%s\t%c\t.\tName=%s\n", gffEscape(ft.Seqid), ft.Start+1, ft.End, score, ft.Strand, gffEscape(ft.Name))
+}
+
+// recordName returns the name of a record, or its index if it has none.
+func recordName(name string, rec int) string {
+	if name == "" {
+		return strconv.Itoa(rec)
+	}
+	return name
+}
+
+// gffEscape percent-encodes the characters GFF3 reserves in column and
+// attribute values.
+func gffEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c == 0x7f || strings.IndexByte("%;=&,", c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// SAM flag bits set on alignment records.
+const (
+	samUnmapped  = 0x4
+	samReverse   = 0x10
+	samSecondary = 0x100
+)
+
+// samReporter writes the hits of -s, -q and -motif queries as SAM alignments
+// against the records of the index, whose names and lengths make up the @SQ
+// header. The first hit of a query is its primary alignment and the others are
+// secondary; a query without hits gets one unmapped record. Reverse-strand
+// hits carry the reverse complemented query as SEQ, so SEQ and CIGAR both read
+// along the forward strand. NM, reported when -k is set or the query is
+// degenerate, counts the bases of SEQ that differ literally from the
+// reference, unlike the hit distance, for which degenerate codes match.
+type samReporter struct {
+	opts      reportOptions
+	started   bool // @HD written
+	sequences bool // @SQ and @PG written
+}
+
+func (s *samReporter) indexStarted(string) {}
+
+func (s *samReporter) indexBuilt(st indexStats) {
+	s.start()
+	fmt.Printf("@CO\tindex %s built from %s (%d records, %d bases) and saved to %s\n", st.Index, st.Genome, st.Records, st.Length, st.Path)
+}
+
+// start writes the @HD line, which must open the header.
+func (s *samReporter) start() {
+	if !s.started {
+		s.started = true
+		fmt.Println("@HD\tVN:1.6\tSO:unsorted")
+	}
+}
+
+// header writes the SAM header from the record table of the searched index.
+// Empty records are left out, as SAM references hold at least one base and
+// no hit falls on them.
+func (s *samReporter) header(g *Genome) {
+	if s.sequences {
+		return
+	}
+	s.start()
+	s.sequences = true
+	for i, rec := range g.Records {
+		if rec.Len > 0 {
+			fmt.Printf("@SQ\tSN:%s\tLN:%d\n", recordName(rec.Name, i), rec.Len)
+		}
+	}
+	fmt.Println("@PG\tID:dnatools\tPN:dnatools")
+}
+
+func (s *samReporter) queryDone(r queryResult) {
+	s.header(r.Genome)
+	qname := r.Query
+	if r.ID != "" {
+		qname = r.ID
+	}
+	if len(r.Hits) == 0 {
+		// A motif is no read sequence, so an unmapped one has none.
+		seq := r.Query
+		if r.Motif {
+			seq = "*"
+		}
+		fmt.Printf("%s\t%d\t*\t0\t0\t*\t*\t0\t0\t%s\t*\n", qname, samUnmapped, seq)
+		return
+	}
+	for i, hit := range r.Hits {
+		start, _, ok := r.Genome.localSpan(hit.Line, hit.Pos, hit.End)
+		if !ok {
+			continue
+		}
+		flag := 0
+		if i > 0 {
+			flag |= samSecondary
+		}
+		seq := r.Query
+		switch {
+		case r.Motif:
+			seq = hit.Matched
+		case hit.Strand == '-':
+			seq = reverseComplement(r.Query)
+		}
+		if hit.Strand == '-' {
+			flag |= samReverse
+		}
+		fmt.Printf("%s\t%d\t%s\t%d\t255\t%s\t*\t0\t0\t%s\t*", qname, flag, recordName(r.Genome.Records[hit.Line].Name, hit.Line), start+1, hit.CIGAR, seq)
+		if s.opts.Search.MaxDist > 0 || !r.Motif && isDegenerate(r.Query) {
+			fmt.Printf("\tNM:i:%d", samEditDistance(seq, hit.Matched, hit.CIGAR))
+		}
+		fmt.Println()
+	}
+}
+
+// samEditDistance returns the NM of an alignment of seq to the reference text
+// matched as described by cigar: the aligned bases that differ literally, so a
+// degenerate code counts even where it matches, plus the inserted and deleted
+// bases.
+func samEditDistance(seq, matched, cigar string) int {
+	nm, i, j, n := 0, 0, 0, 0
+	for _, c := range []byte(cigar) {
+		if '0' <= c && c <= '9' {
+			n = n*10 + int(c-'0')
+			continue
+		}
+		switch c {
+		case 'M':
+			for k := 0; k < n; k++ {
+				if seq[i+k] != matched[j+k] {
+					nm++
+				}
+			}
+			i, j = i+n, j+n
+		case 'I':
+			nm += n
+			i += n
+		case 'D':
+			nm += n
+			j += n
+		}
+		n = 0
+	}
+	return nm
+}
+
+// patternsDone is never called: runApp refuses -t with SAM output, as the
+// streamed genome has no record table for the header.
+func (s *samReporter) patternsDone(string, []patternResult) {}
+
+func (s *samReporter) close() {}
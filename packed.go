@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"slices"
+	"strings"
+)
+
+// byteSeq is read-only random access to a genome text.
+type byteSeq interface {
+	Len() int
+	At(i int) byte
+}
+
+// stringSeq is a byteSeq over an ordinary string.
+type stringSeq string
+
+func (s stringSeq) Len() int      { return len(s) }
+func (s stringSeq) At(i int) byte { return s[i] }
+
+// packedBases maps the two-bit codes back to bases; code order matches byte
+// order so packed texts sort like their plain form.
+const packedBases = "ACGT"
+
+// packedCodes maps A, C, G and T, in either case, to their two-bit codes and
+// every other byte to 0xff.
+var packedCodes = func() [256]byte {
+	var codes [256]byte
+	for i := range codes {
+		codes[i] = 0xff
+	}
+	for code, b := range []byte(packedBases) {
+		codes[b] = byte(code)
+		codes[b+'a'-'A'] = byte(code)
+	}
+	return codes
+}()
+
+// packedSeq stores a genome text at two bits per base, 32 bases to each
+// little-endian 64-bit word. Soft-masked a, c, g and t are packed like their
+// uppercase forms and flagged in the lower bitmap. Any other byte (N runs,
+// other IUPAC codes, '$' separators) is an exception: packed as A, flagged in
+// the exc bitmap and stored in excBytes in text order, where the rank of its
+// bit finds it. Bitmaps hold one bit per base in little-endian 64-bit words and
+// are empty if no base is flagged.
+type packedSeq struct {
+	n     int
+	words []byte
+	lower []byte
+	exc   []byte
+	// excRank holds the number of set exc bits before each 64-bit word.
+	excRank  intArray
+	excBytes []byte
+	distinct []byte // alphabet, once computed
+	// err, set for texts read from an unverified index, receives the first
+	// exception rank found out of range (see checkedPositions).
+	err *error
+}
+
+// packSeq packs text into two bits per base plus its case and exceptions.
+func packSeq(text string) *packedSeq {
+	p := &packedSeq{n: len(text), words: make([]byte, packedWords(len(text))*8)}
+	for i := 0; i < len(text); i++ {
+		b := text[i]
+		code := packedCodes[b]
+		switch {
+		case code == 0xff:
+			if p.exc == nil {
+				p.exc = make([]byte, bitmapBytes(len(text)))
+			}
+			setBit(p.exc, i)
+			p.excBytes = append(p.excBytes, b)
+			code = 0
+		case b >= 'a':
+			if p.lower == nil {
+				p.lower = make([]byte, bitmapBytes(len(text)))
+			}
+			setBit(p.lower, i)
+		}
+		w := i / 32 * 8
+		word := binary.LittleEndian.Uint64(p.words[w:]) | uint64(code)<<(uint(i%32)*2)
+		binary.LittleEndian.PutUint64(p.words[w:], word)
+	}
+	p.excRank = bitmapRank(p.exc)
+	return p
+}
+
+// packedWords returns the number of 64-bit words holding n bases.
+func packedWords(n int) int {
+	return (n + 31) / 32
+}
+
+// bitmapBytes returns the size of a bitmap of n bits.
+func bitmapBytes(n int) int {
+	return (n + 63) / 64 * 8
+}
+
+func setBit(bitmap []byte, i int) {
+	bitmap[i/8] |= 1 << uint(i%8)
+}
+
+func hasBit(bitmap []byte, i int) bool {
+	return bitmap[i/8]>>uint(i%8)&1 != 0
+}
+
+// bitmapRank returns the number of set bits before every 64-bit word of bitmap.
+func bitmapRank(bitmap []byte) intArray {
+	rank := make(intSlice, len(bitmap)/8)
+	for w := 1; w < len(rank); w++ {
+		rank[w] = rank[w-1] + bits.OnesCount64(binary.LittleEndian.Uint64(bitmap[(w-1)*8:]))
+	}
+	return rank
+}
+
+func (p *packedSeq) Len() int {
+	return p.n
+}
+
+// At returns base i.
+func (p *packedSeq) At(i int) byte {
+	if len(p.exc) > 0 && hasBit(p.exc, i) {
+		w := i / 64
+		word := binary.LittleEndian.Uint64(p.exc[w*8:])
+		k := p.excRank.At(w) + bits.OnesCount64(word&(1<<uint(i%64)-1))
+		if p.err != nil && (k < 0 || k >= len(p.excBytes)) {
+			corrupt(p.err, "text exception %d out of range at position %d", k, i)
+			return 'N'
+		}
+		return p.excBytes[k]
+	}
+	word := binary.LittleEndian.Uint64(p.words[i/32*8:])
+	b := packedBases[word>>(uint(i%32)*2)&3]
+	if len(p.lower) > 0 && hasBit(p.lower, i) {
+		b += 'a' - 'A'
+	}
+	return b
+}
+
+// alphabet returns the bytes that may occur in the text, in byte order: the
+// four bases, their lowercase forms if any base is soft-masked, and every
+// exception byte. The caller must not modify the result.
+func (p *packedSeq) alphabet() []byte {
+	if p.distinct != nil {
+		return p.distinct
+	}
+	bytes := []byte(packedBases)
+	if len(p.lower) > 0 {
+		bytes = append(bytes, strings.ToLower(packedBases)...)
+	}
+	var seen [256]bool
+	for _, b := range p.excBytes {
+		if !seen[b] {
+			seen[b] = true
+			bytes = append(bytes, b)
+		}
+	}
+	slices.Sort(bytes)
+	p.distinct = bytes
+	return bytes
+}
+
+// String unpacks the whole text.
+func (p *packedSeq) String() string {
+	var b strings.Builder
+	b.Grow(p.n)
+	for i := 0; i < p.n; i++ {
+		b.WriteByte(p.At(i))
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestPackedSeqRoundTrip(t *testing.T) {
+	texts := []string{
+		"",
+		"ACGT",
+		"ACGTNNNNNNACGT$TTGCARYacgtNN",
+		"NNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNNA", // exceptions across a bitmap word
+		"acgtNNacgtRYACGT$gattaca",
+	}
+	rng := rand.New(rand.NewSource(1))
+	b := make([]byte, 1000)
+	for i := range b {
+		b[i] = "ACGTACGTACGTN$Racgt"[rng.Intn(19)]
+	}
+	texts = append(texts, string(b))
+
+	for _, text := range texts {
+		p := packSeq(text)
+		if p.Len() != len(text) {
+			t.Errorf("Packed length of %q: got %d, expected %d", text, p.Len(), len(text))
+		}
+		if got := p.String(); got != text {
+			t.Errorf("Packed round trip: got %q, expected %q", got, text)
+		}
+		if len(p.words) != packedWords(len(text))*8 {
+			t.Errorf("Packed %d bases into %d bytes", len(text), len(p.words))
+		}
+	}
+
+	// Only bytes other than the four bases, in either case, are exceptions;
+	// soft-masked bases are flagged in the lowercase bitmap instead.
+	p := packSeq("ANNacgtNC")
+	if string(p.excBytes) != "NNN" || len(p.lower) != 8 || p.lower[0] != 0b1111000 {
+		t.Errorf("Exceptions %q and lowercase bitmap %v", p.excBytes, p.lower)
+	}
+	if p := packSeq("acgt"); p.exc != nil || p.excBytes != nil {
+		t.Errorf("Lowercase bases stored as exceptions: %q", p.excBytes)
+	}
+}
+
+func TestPackedSuffixArrayAndLCP(t *testing.T) {
+	for _, text := range []string{"banana", "ACGT$TGCA", "GATTACANNNNGATTACA$ACGTRYACGT"} {
+		encoded, alphabetSize := encodeString(text)
+		expectedSA := SAISEntryPoint(encoded, alphabetSize)
+		p := packSeq(text)
+		sa := SAISText(p)
+		if !reflect.DeepEqual(toInts(sa), expectedSA) {
+			t.Errorf("Packed suffix array of %q: got %v, expected %v", text, sa, expectedSA)
+		}
+		if lcp, expected := toInts(computeLCPText(p, sa)), computeLCP(text, expectedSA); !reflect.DeepEqual(lcp, expected) {
+			t.Errorf("Packed LCP of %q: got %v, expected %v", text, lcp, expected)
+		}
+	}
+}
@@ -1,19 +1,90 @@
 package main
 
-import "strings"
+import "math"
 
 func SAISEntryPoint(s []int, K int) []int {
 	n := len(s)
-	return SAIS(s, K, n, make([]int, n), make([]int, n))
+	return SAIS(intSymbols[int](s), K, n, make([]int, n))
 }
 
-// SAIS constructs the suffix array for s using the SAIS algorithm.
-// s is expected to have a trailing sentinel (0).
-func SAIS(s []int, K int, n int, SA []int, lmsNames []int) []int {
-	SA = SA[:n]
-	for i := range SA {
-		SA[i] = -1
+// SAISText constructs the suffix array of a genome text plus sentinel directly
+// from a byteSeq such as a packedSeq, without expanding it to one int per base.
+// Positions are held in 32 bits whenever they fit.
+func SAISText(text byteSeq) intArray {
+	s := textSymbols{text}
+	n := s.Len()
+	if n < math.MaxInt32 {
+		return int32Slice(SAIS(s, 257, n, make([]int32, n)))
 	}
+	return intSlice(SAIS(s, 257, n, make([]int, n)))
+}
+
+// suffixInt is the element type of a suffix array under construction.
+type suffixInt interface {
+	~int32 | ~int
+}
+
+// symbolSeq is the input alphabet of SAIS: integers below K, the last of
+// which is a unique sentinel 0.
+type symbolSeq interface {
+	Len() int
+	At(i int) int
+}
+
+// intSymbols is an already encoded symbol string, as made by encodeString and
+// by SAIS for its reduced problems.
+type intSymbols[I suffixInt] []I
+
+func (s intSymbols[I]) Len() int     { return len(s) }
+func (s intSymbols[I]) At(i int) int { return int(s[i]) }
+
+// textSymbols encodes a text on the fly like encodeString: each byte shifted
+// by +1, followed by the sentinel 0.
+type textSymbols struct {
+	text byteSeq
+}
+
+func (s textSymbols) Len() int { return s.text.Len() + 1 }
+
+func (s textSymbols) At(i int) int {
+	if i == s.text.Len() {
+		return 0
+	}
+	return int(s.text.At(i)) + 1
+}
+
+// suffixTypes holds one bit per suffix, set for S-type suffixes.
+type suffixTypes []uint64
+
+func classifySuffixes[S symbolSeq](s S, n int) suffixTypes {
+	t := make(suffixTypes, (n+63)/64)
+	t[(n-1)/64] |= 1 << uint((n-1)%64)
+	for i := n - 2; i >= 0; i-- {
+		if a, b := s.At(i), s.At(i+1); a < b || a == b && t.isS(i+1) {
+			t[i/64] |= 1 << uint(i%64)
+		}
+	}
+	return t
+}
+
+func (t suffixTypes) isS(i int) bool {
+	return t[i/64]>>uint(i%64)&1 != 0
+}
+
+// isLMS reports whether i is a leftmost S-type position.
+func (t suffixTypes) isLMS(i int) bool {
+	return i > 0 && t.isS(i) && !t.isS(i-1)
+}
+
+// SAIS constructs the suffix array for s using the SAIS algorithm, in SA, which
+// must hold at least n elements. s is expected to have a trailing sentinel (0).
+// Besides SA it allocates one bit per symbol for the suffix types and one
+// bucket pointer per alphabet symbol: the sorted LMS substrings, their names
+// and the reduced problem all live in SA, whose front also holds the suffix
+// array of the reduced problem (LMS positions are at least two apart, so there
+// are at most n/2 of them).
+func SAIS[S symbolSeq, I suffixInt](s S, K int, n int, SA []I) []I {
+	SA = SA[:n]
 	if n == 0 {
 		return SA
 	}
@@ -21,139 +92,154 @@ func SAIS(s []int, K int, n int, SA []int, lmsNames []int) []int {
 		SA[0] = 0
 		return SA
 	}
-	t := make([]bool, n)
-	t[n-1] = true
-	for i := n - 2; i >= 0; i-- {
-		if s[i] < s[i+1] {
-			t[i] = true
-		} else if s[i] > s[i+1] {
-			t[i] = false
-		} else {
-			t[i] = t[i+1]
-		}
+	t := classifySuffixes(s, n)
+	bkt := make([]I, K)
+
+	// Sort the LMS substrings by placing the LMS positions at the tails of
+	// their buckets and inducing.
+	for i := range SA {
+		SA[i] = -1
 	}
-	var lmsPositions []int
-	for i := 1; i < n; i++ {
-		if t[i] && !t[i-1] {
-			lmsPositions = append(lmsPositions, i)
+	bucketTails(s, bkt)
+	for i := n - 1; i > 0; i-- {
+		if t.isLMS(i) {
+			c := s.At(i)
+			SA[bkt[c]] = I(i)
+			bkt[c]--
 		}
 	}
-	SA = induceSort(s, SA, t, K, lmsPositions)
-	var sortedLMS []int
-	for _, pos := range SA {
-		if pos > 0 && t[pos] && !t[pos-1] {
-			sortedLMS = append(sortedLMS, pos)
+	induceSort(s, SA, t, bkt)
+
+	// Compact the sorted LMS positions into SA[:m] and name their substrings,
+	// storing the name of position pos at SA[m+pos/2].
+	m := 0
+	for i := 0; i < n; i++ {
+		if t.isLMS(int(SA[i])) {
+			SA[m] = SA[i]
+			m++
 		}
 	}
-	lmsNames = lmsNames[:n]
-	for i := range lmsNames {
-		lmsNames[i] = -1
+	for i := m; i < n; i++ {
+		SA[i] = -1
 	}
-	name := 0
-	prev := -1
-	for _, pos := range sortedLMS {
-		if prev == -1 {
-			lmsNames[pos] = name
-		} else {
-			if !lmsSubstringEqual(s, t, prev, pos) {
-				name++
-			}
-			lmsNames[pos] = name
+	name, prev := -1, -1
+	for i := 0; i < m; i++ {
+		pos := int(SA[i])
+		if prev < 0 || !lmsSubstringEqual(s, t, prev, pos) {
+			name++
 		}
+		SA[m+pos/2] = I(name)
 		prev = pos
 	}
 	numNames := name + 1
-	reduced := make([]int, 0, len(lmsPositions))
-	for _, pos := range lmsPositions {
-		reduced = append(reduced, lmsNames[pos])
+	// Gather the names in text order at the end of SA: the reduced string.
+	j := n - 1
+	for i := n - 1; i >= m; i-- {
+		if SA[i] >= 0 {
+			SA[j] = SA[i]
+			j--
+		}
 	}
-	var reducedSA []int
-	if numNames < len(reduced) {
-		reducedSA = SAIS(reduced, numNames, len(reduced), SA, lmsNames)
+	reduced := SA[n-m:]
+	if numNames < m {
+		SAIS(intSymbols[I](reduced), numNames, m, SA[:m])
 	} else {
-		reducedSA = make([]int, len(reduced))
-		for i, name := range reduced {
-			reducedSA[name] = i
+		for i, c := range reduced {
+			SA[c] = I(i)
+		}
+	}
+
+	// Map the sorted reduced suffixes back to their LMS positions, then induce
+	// the full suffix array from them, placed at their bucket tails from the
+	// last: each lands at or after its own slot in SA[:m].
+	k := 0
+	for i := 1; i < n; i++ {
+		if t.isLMS(i) {
+			reduced[k] = I(i)
+			k++
 		}
 	}
-	orderedLMS := make([]int, len(reducedSA))
-	for i, idx := range reducedSA {
-		orderedLMS[i] = lmsPositions[idx]
+	for i := 0; i < m; i++ {
+		SA[i] = reduced[SA[i]]
 	}
-	for i := range SA {
+	for i := m; i < n; i++ {
+		SA[i] = -1
+	}
+	bucketTails(s, bkt)
+	for i := m - 1; i >= 0; i-- {
+		pos := SA[i]
 		SA[i] = -1
+		c := s.At(int(pos))
+		SA[bkt[c]] = pos
+		bkt[c]--
 	}
-	SA = induceSort(s, SA, t, K, orderedLMS)
+	induceSort(s, SA, t, bkt)
 	return SA
 }
 
-func induceSort(s []int, SA []int, t []bool, K int, lms []int) []int {
-	bs := computeBucketSizes(s, K)
-	bucketTails := computeBucketTails(bs)
-	for i := len(lms) - 1; i >= 0; i-- {
-		pos := lms[i]
-		c := s[pos]
-		SA[bucketTails[c]] = pos
-		bucketTails[c]--
-	}
-	bucketHeads := computeBucketHeads(bs)
+// induceSort induces the L-type suffixes from the suffixes placed in SA, then
+// the S-type suffixes from those.
+func induceSort[S symbolSeq, I suffixInt](s S, SA []I, t suffixTypes, bkt []I) {
+	bucketHeads(s, bkt)
 	for i := range SA {
-		pos := SA[i]
-		if pos > 0 && !t[pos-1] {
-			c := s[pos-1]
-			SA[bucketHeads[c]] = pos - 1
-			bucketHeads[c]++
+		if pos := int(SA[i]); pos > 0 && !t.isS(pos-1) {
+			c := s.At(pos - 1)
+			SA[bkt[c]] = I(pos - 1)
+			bkt[c]++
 		}
 	}
-	bucketTails = computeBucketTails(bs)
+	bucketTails(s, bkt)
 	for i := len(SA) - 1; i >= 0; i-- {
-		pos := SA[i]
-		if pos > 0 && t[pos-1] {
-			c := s[pos-1]
-			SA[bucketTails[c]] = pos - 1
-			bucketTails[c]--
+		if pos := int(SA[i]); pos > 0 && t.isS(pos-1) {
+			c := s.At(pos - 1)
+			SA[bkt[c]] = I(pos - 1)
+			bkt[c]--
 		}
 	}
-	return SA
 }
 
-func computeBucketSizes(s []int, K int) []int {
-	bs := make([]int, K)
-	for i := 0; i < len(s); i++ {
-		bs[s[i]]++
+// countSymbols sets bkt[c] to the number of occurrences of c in s.
+func countSymbols[S symbolSeq, I suffixInt](s S, bkt []I) {
+	for c := range bkt {
+		bkt[c] = 0
+	}
+	for i := 0; i < s.Len(); i++ {
+		bkt[s.At(i)]++
 	}
-	return bs
 }
 
-func computeBucketHeads(bs []int) []int {
-	heads := make([]int, len(bs))
-	sum := 0
-	for i, v := range bs {
-		heads[i] = sum
+// bucketHeads sets bkt[c] to the first slot of the suffixes starting with c.
+func bucketHeads[S symbolSeq, I suffixInt](s S, bkt []I) {
+	countSymbols(s, bkt)
+	var sum I
+	for c, v := range bkt {
+		bkt[c] = sum
 		sum += v
 	}
-	return heads
 }
 
-func computeBucketTails(bs []int) []int {
-	tails := make([]int, len(bs))
-	sum := 0
-	for i, v := range bs {
+// bucketTails sets bkt[c] to the last slot of the suffixes starting with c.
+func bucketTails[S symbolSeq, I suffixInt](s S, bkt []I) {
+	countSymbols(s, bkt)
+	var sum I
+	for c, v := range bkt {
 		sum += v
-		tails[i] = sum - 1
+		bkt[c] = sum - 1
 	}
-	return tails
 }
 
-func lmsSubstringEqual(s []int, t []bool, i, j int) bool {
-	n := len(s)
-	for {
-		if s[i] != s[j] {
+// lmsSubstringEqual reports whether the LMS substrings starting at i and j are
+// equal: same characters and types up to and including the next LMS position.
+func lmsSubstringEqual[S symbolSeq](s S, t suffixTypes, i, j int) bool {
+	n := s.Len()
+	for first := true; ; first = false {
+		if s.At(i) != s.At(j) || t.isS(i) != t.isS(j) {
 			return false
 		}
-		iIsLMS := (i > 0 && t[i] && !t[i-1])
-		jIsLMS := (j > 0 && t[j] && !t[j-1])
-		if iIsLMS && jIsLMS {
+		iIsLMS := t.isLMS(i)
+		jIsLMS := t.isLMS(j)
+		// Both substrings start at an LMS position; they end at the next one.
+		if !first && iIsLMS && jIsLMS {
 			return true
 		}
 		if iIsLMS != jIsLMS {
@@ -168,39 +254,40 @@ func lmsSubstringEqual(s []int, t []bool, i, j int) bool {
 	return false
 }
 
-// searchSequence uses binary search on the suffix entries to locate all occurrences of query.
-func searchSequence(genome string, entries []SuffixEntry, query string) []SuffixEntry {
-	lb := lowerBound(genome, entries, query)
-	if lb == -1 {
-		return []SuffixEntry{}
+// searchSequence uses binary search on the suffix array (or backward search on
+// the FM-index) to locate all occurrences of query.
+func searchSequence(idx *Index, query string) []SuffixEntry {
+	lb, ub := idx.interval(query)
+	results := make([]SuffixEntry, 0, ub-lb)
+	for i := lb; i < ub; i++ {
+		results = append(results, idx.Entry(i))
 	}
-	ub := upperBound(genome, entries, query)
-	return entries[lb:ub]
+	return results
 }
 
-func lowerBound(genome string, entries []SuffixEntry, query string) int {
+func lowerBound(genome byteSeq, sa intArray, query string) int {
 	lo := 0
-	hi := len(entries)
+	hi := sa.Len()
 	for lo < hi {
 		mid := (lo + hi) / 2
-		if compareSuffix(genome, entries[mid].Pos, query) < 0 {
+		if compareSuffix(genome, sa.At(mid), query) < 0 {
 			lo = mid + 1
 		} else {
 			hi = mid
 		}
 	}
-	if lo < len(entries) && strings.HasPrefix(genome[entries[lo].Pos:], query) {
+	if lo < sa.Len() && compareSuffix(genome, sa.At(lo), query) == 0 {
 		return lo
 	}
 	return -1
 }
 
-func upperBound(genome string, entries []SuffixEntry, query string) int {
+func upperBound(genome byteSeq, sa intArray, query string) int {
 	lo := 0
-	hi := len(entries)
+	hi := sa.Len()
 	for lo < hi {
 		mid := (lo + hi) / 2
-		if compareSuffix(genome, entries[mid].Pos, query) <= 0 {
+		if compareSuffix(genome, sa.At(mid), query) <= 0 {
 			lo = mid + 1
 		} else {
 			hi = mid
@@ -209,11 +296,11 @@ func upperBound(genome string, entries []SuffixEntry, query string) int {
 	return lo
 }
 
-func compareSuffix(genome string, pos int, query string) int {
+func compareSuffix(genome byteSeq, pos int, query string) int {
 	i := 0
-	for i < len(query) && pos+i < len(genome) {
-		if genome[pos+i] != query[i] {
-			return int(genome[pos+i]) - int(query[i])
+	for i < len(query) && pos+i < genome.Len() {
+		if c := genome.At(pos + i); c != query[i] {
+			return int(c) - int(query[i])
 		}
 		i++
 	}
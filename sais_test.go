@@ -1,8 +1,10 @@
 package main
 
 import (
+	"math/rand"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -40,6 +42,31 @@ func TestSuffixArray(t *testing.T) {
 	}
 }
 
+func TestSuffixArrayRandom(t *testing.T) {
+	// Compare SAIS against a naive sort on many small strings over small
+	// alphabets, where equal LMS substrings are frequent.
+	rng := rand.New(rand.NewSource(1))
+	for it := 0; it < 2000; it++ {
+		b := make([]byte, rng.Intn(40))
+		alphabet := "ab$c"[:1+rng.Intn(4)]
+		for i := range b {
+			b[i] = alphabet[rng.Intn(len(alphabet))]
+		}
+		input := string(b)
+		expected := make([]int, len(input)+1)
+		for i := range expected {
+			expected[i] = i
+		}
+		sort.Slice(expected, func(i, j int) bool { return input[expected[i]:] < input[expected[j]:] })
+
+		encoded, alphabetSize := encodeString(input)
+		sa := SAISEntryPoint(encoded, alphabetSize)
+		if !reflect.DeepEqual(sa, expected) {
+			t.Fatalf("Suffix array for %q: got %v, expected %v", input, sa, expected)
+		}
+	}
+}
+
 func TestComputeLCP(t *testing.T) {
 	// For "banana", the expected suffix array is [6,5,3,1,0,4,2]
 	// and the expected LCP array is [0, 0, 1, 3, 0, 0, 2]
@@ -95,16 +122,35 @@ func TestEnhancedIndex(t *testing.T) {
 	// Additionally, test the save/load index functionality.
 	tmpFile := "test_sa.idx"
 	defer os.Remove(tmpFile)
-	if err := saveIndex(tmpFile, entries); err != nil {
+	g := &Genome{Text: genome, Records: []Record{{Start: 0, Len: 4}, {Start: 5, Len: 4}}}
+	if err := saveIndex(tmpFile, indexFromEntries(entries, g)); err != nil {
 		t.Fatalf("Failed to save index: %v", err)
 	}
-	loadedEntries, err := loadIndex(tmpFile)
+	loaded, err := loadIndex(tmpFile)
 	if err != nil {
 		t.Fatalf("Failed to load index: %v", err)
 	}
+	defer loaded.Close()
+	loadedEntries := make([]SuffixEntry, loaded.Len())
+	for i := range loadedEntries {
+		loadedEntries[i] = loaded.Entry(i)
+	}
 	if !reflect.DeepEqual(loadedEntries, entries) {
 		t.Errorf("Loaded entries do not match. Got %v, expected %v", loadedEntries, entries)
 	}
+	if loaded.text.String() != genome || !reflect.DeepEqual(loaded.Genome.Records, g.Records) {
+		t.Errorf("Loaded genome does not match. Got %q %+v, expected %q %+v", loaded.text.String(), loaded.Genome.Records, genome, g.Records)
+	}
+}
+
+// indexFromEntries builds an in-memory index over g from suffix entries.
+func indexFromEntries(entries []SuffixEntry, g *Genome) *Index {
+	var sa, lcp intSlice
+	for _, e := range entries {
+		sa = append(sa, e.Pos)
+		lcp = append(lcp, e.LCP)
+	}
+	return &Index{SA: sa, LCP: lcp, text: packSeq(g.Text), Genome: g, Fingerprint: g.Fingerprint()}
 }
 
 func TestSearchSequence(t *testing.T) {
@@ -138,8 +184,9 @@ func TestSearchSequence(t *testing.T) {
 	}
 
 	// Search for a query that should occur in the first sequence ("ACGT").
+	idx := indexFromEntries(entries, &Genome{Text: genome, Records: []Record{{Start: 0, Len: 4}, {Start: 5, Len: 4}}})
 	query := "CG"
-	results := searchSequence(genome, entries, query)
+	results := searchSequence(idx, query)
 	if len(results) == 0 {
 		t.Errorf("Expected to find query %q in genome", query)
 	}
@@ -151,7 +198,7 @@ func TestSearchSequence(t *testing.T) {
 
 	// Search for a query that should occur in the second sequence ("TGCA").
 	query2 := "GC"
-	results2 := searchSequence(genome, entries, query2)
+	results2 := searchSequence(idx, query2)
 	if len(results2) == 0 {
 		t.Errorf("Expected to find query %q in genome", query2)
 	}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// searchOptions selects how -s and -q queries are matched.
+type searchOptions struct {
+	Strand string // strandForward, strandReverse or strandBoth
+	// MaxDist allows up to MaxDist substitutions, or edits if Indels is set.
+	MaxDist int
+	Indels  bool
+	// MaxExpansions caps the concrete sequences a degenerate query stands for.
+	MaxExpansions int
+	// Limit caps the hits located and printed per query; 0 means no limit.
+	Limit int
+	// Bounds, if set, lets exact queries reuse the intervals of the previous
+	// query searched with it.
+	Bounds *intervalCache
+}
+
+// interval returns the rows prefixed by query, through opts.Bounds if set.
+func (opts searchOptions) interval(idx *Index, query string) (lo, hi int) {
+	if opts.Bounds != nil {
+		return opts.Bounds.interval(idx, query)
+	}
+	return idx.interval(query)
+}
+
+// intervalCache remembers the suffix array interval after every base of the
+// previous query, in the order the index consumes bases (see queryOffset). A
+// query sharing a prefix with the previous one (a suffix, for the FM-index)
+// resumes narrowing from the interval of the shared part, so a sorted batch
+// of queries (see sortForIndex) skips most of the binary or backward search.
+// A cache serves one index only.
+type intervalCache struct {
+	walked []byte   // the previous query in walk order
+	bounds [][2]int // bounds[d] is the interval after d bases
+}
+
+func (c *intervalCache) interval(idx *Index, query string) (lo, hi int) {
+	walked := make([]byte, len(query))
+	for d := range walked {
+		walked[d] = query[idx.queryOffset(d, len(query))]
+	}
+	shared := 0
+	for shared < len(walked) && shared < len(c.walked) && walked[shared] == c.walked[shared] {
+		shared++
+	}
+	if len(c.bounds) == 0 {
+		c.bounds = [][2]int{{0, idx.Len()}}
+	}
+	c.bounds = c.bounds[:shared+1]
+	lo, hi = c.bounds[shared][0], c.bounds[shared][1]
+	for d := shared; d < len(walked); d++ {
+		if lo < hi {
+			lo, hi = idx.extend(lo, hi, d, walked[d])
+		}
+		c.bounds = append(c.bounds, [2]int{lo, hi})
+	}
+	c.walked = walked
+	return lo, hi
+}
+
+// sortForIndex orders queries so that consecutive ones share as long a walk
+// prefix as possible on idx: by sequence for the suffix array and by reversed
+// sequence for the FM-index.
+func sortForIndex(idx *Index, queries []namedSeq) []namedSeq {
+	key := func(q namedSeq) string {
+		if idx.fm == nil {
+			return q.seq
+		}
+		b := []byte(q.seq)
+		slices.Reverse(b)
+		return string(b)
+	}
+	sorted := slices.Clone(queries)
+	slices.SortStableFunc(sorted, func(a, b namedSeq) int { return strings.Compare(key(a), key(b)) })
+	return sorted
+}
+
+// searchHit is a hit of a -s or -q query: the suffix array entry of its start
+// and its end, the strand it was found on and, for approximate searches, its
+// distance and alignment. Pos is always the leftmost forward-strand position
+// of the match, Mismatches holds the offsets of substitutions from Pos when
+// only substitutions are allowed, and Matched is the forward-strand text the
+// query matched.
+type searchHit struct {
+	SuffixEntry
+	End        int
+	Strand     byte
+	Distance   int
+	CIGAR      string
+	Mismatches []int
+	Matched    string
+}
+
+// mirrored reports whether a hit of orientation q on the text matched repeats
+// a forward hit in a search of both strands. Text equal to its own reverse
+// complement matches the query exactly as well as it matches the reverse
+// complement, so the forward orientation reports it already. Exact queries
+// need no check, as strandQueries searches palindromic ones once.
+func (opts searchOptions) mirrored(q strandQuery, matched string) bool {
+	return opts.Strand == strandBoth && q.Strand == '-' && isPalindromic(matched)
+}
+
+// searchQuery searches every orientation of query selected by opts, returning
+// the forward hits before the reverse ones, at most opts.Limit of them if set.
+// Exact queries without degenerate IUPAC codes take a single interval lookup;
+// the others walk the index. Exact and substitution searches locate no more
+// rows than the limit.
+func searchQuery(idx *Index, query string, opts searchOptions) ([]searchHit, error) {
+	if err := checkExpansions(query, opts.MaxExpansions); err != nil {
+		return nil, err
+	}
+	var hits []searchHit
+	full := func() bool { return opts.Limit > 0 && len(hits) >= opts.Limit }
+	for _, q := range strandQueries(query, opts.Strand) {
+		cigar := fmt.Sprintf("%dM", len(q.Seq))
+		switch {
+		case opts.Indels && opts.MaxDist > 0:
+			for _, hit := range searchEdit(idx, q.Seq, opts.MaxDist) {
+				if full() {
+					break
+				}
+				if opts.mirrored(q, hit.Matched) {
+					continue
+				}
+				hits = append(hits, searchHit{hit.SuffixEntry, hit.End, q.Strand, hit.Distance, hit.CIGAR, nil, hit.Matched})
+			}
+		case opts.MaxDist > 0 || isDegenerate(q.Seq):
+			hammingIntervals(idx, q.Seq, opts.MaxDist, func(lo, hi int, mismatches []int, matched string) bool {
+				if opts.mirrored(q, matched) {
+					return true
+				}
+				for i := lo; i < hi && !full(); i++ {
+					entry := idx.Entry(i)
+					hits = append(hits, searchHit{entry, entry.Pos + len(q.Seq), q.Strand, len(mismatches), cigar, mismatches, matched})
+				}
+				return !full()
+			})
+		default:
+			lo, hi := opts.interval(idx, q.Seq)
+			for i := lo; i < hi && !full(); i++ {
+				entry := idx.Entry(i)
+				hits = append(hits, searchHit{entry, entry.Pos + len(q.Seq), q.Strand, 0, cigar, nil, q.Seq})
+			}
+		}
+	}
+	return hits, nil
+}
+
+// countQuery returns the number of hits searchQuery would find without a
+// limit. Exact and substitution searches only add up interval sizes and
+// locate nothing; edit distance searches must locate their hits to report
+// each anchor once.
+func countQuery(idx *Index, query string, opts searchOptions) (int, error) {
+	if err := checkExpansions(query, opts.MaxExpansions); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, q := range strandQueries(query, opts.Strand) {
+		switch {
+		case opts.Indels && opts.MaxDist > 0:
+			for _, hit := range searchEdit(idx, q.Seq, opts.MaxDist) {
+				if !opts.mirrored(q, hit.Matched) {
+					count++
+				}
+			}
+		case opts.MaxDist > 0 || isDegenerate(q.Seq):
+			hammingIntervals(idx, q.Seq, opts.MaxDist, func(lo, hi int, _ []int, matched string) bool {
+				if !opts.mirrored(q, matched) {
+					count += hi - lo
+				}
+				return true
+			})
+		default:
+			lo, hi := opts.interval(idx, q.Seq)
+			count += hi - lo
+		}
+	}
+	return count, nil
+}
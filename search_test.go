@@ -0,0 +1,69 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestCountQueryAndLimit(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	g := randomGenome(rng, 2, 300)
+	queries := []string{"ACG", "AC", "GATTACA", "RYN", "TTTT"}
+	optionSets := []searchOptions{
+		{Strand: strandForward},
+		{Strand: strandBoth},
+		{Strand: strandForward, MaxDist: 1},
+		{Strand: strandBoth, MaxDist: 1, Indels: true},
+	}
+	for _, backend := range []string{backendSA, backendFM} {
+		idx := buildIndex(g, indexOptions{Backend: backend})
+		for _, opts := range optionSets {
+			opts.MaxExpansions = defaultMaxExpansions
+			for _, q := range queries {
+				all, err := searchQuery(idx, q, opts)
+				if err != nil {
+					t.Fatalf("searchQuery(%q): %v", q, err)
+				}
+				count, err := countQuery(idx, q, opts)
+				if err != nil {
+					t.Fatalf("countQuery(%q): %v", q, err)
+				}
+				if count != len(all) {
+					t.Errorf("%s %+v: query %q counted %d hits, found %d", backend, opts, q, count, len(all))
+				}
+				limited := opts
+				limited.Limit = 3
+				some, _ := searchQuery(idx, q, limited)
+				if len(some) != min(3, len(all)) || !reflect.DeepEqual(some, all[:len(some)]) {
+					t.Errorf("%s %+v: query %q limited to %d hits, expected the first %d of %d", backend, opts, q, len(some), min(3, len(all)), len(all))
+				}
+			}
+		}
+	}
+}
+
+func TestIntervalCacheMatchesInterval(t *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+	g := randomGenome(rng, 2, 300)
+	var queries []namedSeq
+	for i := 0; i < 200; i++ {
+		start := rng.Intn(len(g.Text) - 8)
+		queries = append(queries, namedSeq{seq: g.Text[start : start+1+rng.Intn(8)]})
+	}
+	queries = append(queries, namedSeq{seq: "ACGTACGTACGTACGT"}, namedSeq{seq: "X"})
+	for _, backend := range []string{backendSA, backendFM} {
+		idx := buildIndex(g, indexOptions{Backend: backend})
+		// Sorted and unsorted orders both give the plain intervals.
+		for _, batch := range [][]namedSeq{sortForIndex(idx, queries), queries} {
+			cache := &intervalCache{}
+			for _, q := range batch {
+				lo, hi := cache.interval(idx, q.seq)
+				elo, ehi := idx.interval(q.seq)
+				if hi-lo != ehi-elo || lo < hi && lo != elo {
+					t.Errorf("%s: query %q: cached interval [%d, %d), expected [%d, %d)", backend, q.seq, lo, hi, elo, ehi)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Strand selections for -strand: the forward strand as written, the reverse
+// complement only, or both.
+const (
+	strandForward = "+"
+	strandReverse = "-"
+	strandBoth    = "both"
+)
+
+// parseStrand validates a -strand value.
+func parseStrand(s string) (string, error) {
+	switch s {
+	case strandForward, strandReverse, strandBoth:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown strand %q (use %s, %s or %s)", s, strandForward, strandReverse, strandBoth)
+}
+
+// complements maps every IUPAC nucleotide code to its complement, keeping case.
+// Bytes that are not nucleotide codes complement to themselves.
+var complements = func() [256]byte {
+	var c [256]byte
+	for i := range c {
+		c[i] = byte(i)
+	}
+	for _, pair := range []string{"AT", "CG", "RY", "KM", "BV", "DH", "SS", "WW", "NN"} {
+		for _, p := range []string{pair, string([]byte{pair[0] + 'a' - 'A', pair[1] + 'a' - 'A'})} {
+			c[p[0]], c[p[1]] = p[1], p[0]
+		}
+	}
+	c['U'], c['u'] = 'A', 'a'
+	return c
+}()
+
+// reverseComplement returns the reverse complement of seq, complementing IUPAC
+// ambiguity codes as well as plain bases.
+func reverseComplement(seq string) string {
+	rc := make([]byte, len(seq))
+	for i := 0; i < len(seq); i++ {
+		rc[len(seq)-1-i] = complements[seq[i]]
+	}
+	return string(rc)
+}
+
+// isPalindromic reports whether seq equals its own reverse complement, so a
+// site matching it reads the same on both strands.
+func isPalindromic(seq string) bool {
+	return reverseComplement(seq) == seq
+}
+
+// strandQuery is one orientation of a query to search for: the sequence as it
+// appears on the forward strand and the strand it reports.
+type strandQuery struct {
+	Seq    string
+	Strand byte
+}
+
+// strandQueries returns the orientations of query selected by strand. A
+// palindromic query, equal to its own reverse complement, is searched once so
+// its hits are not reported twice.
+func strandQueries(query, strand string) []strandQuery {
+	rc := reverseComplement(query)
+	switch {
+	case strand == strandReverse:
+		return []strandQuery{{rc, '-'}}
+	case strand == strandBoth && rc != query:
+		return []strandQuery{{query, '+'}, {rc, '-'}}
+	}
+	return []strandQuery{{query, '+'}}
+}
+
+// strandTrie inserts the orientations of every pattern selected by strand into
+// trie, expanding degenerate IUPAC codes into one branch per concrete
+// sequence. It returns, for each inserted sequence, the input patterns and
+// strands a match of it stands for. A palindromic sequence that a pattern
+// matches on the forward strand stands for that pattern on the forward strand
+// only, so degenerate patterns such as "AN" report each "AT" site once.
+func strandTrie(trie *TrieNode, patterns []string, strand string, maxExpansions int) (map[string][]strandQuery, error) {
+	targets := make(map[string][]strandQuery)
+	for _, p := range patterns {
+		if err := checkExpansions(p, maxExpansions); err != nil {
+			return nil, err
+		}
+		for _, q := range strandQueries(p, strand) {
+			for _, seq := range expandIUPAC(q.Seq) {
+				if _, seen := targets[seq]; !seen {
+					trie.Insert(seq)
+				}
+				target := strandQuery{p, q.Strand}
+				if q.Strand == '-' && isPalindromic(seq) && slices.Contains(targets[seq], strandQuery{p, '+'}) {
+					continue
+				}
+				if !slices.Contains(targets[seq], target) {
+					targets[seq] = append(targets[seq], target)
+				}
+			}
+		}
+	}
+	return targets, nil
+}
+
+// orientTrieHits maps the hits of the inserted sequences back to the input
+// patterns they stand for, setting their strand and the concrete sequence
+// matched. Each pattern's hits are
+// ordered by position, forward before reverse at the same position.
+func orientTrieHits(results map[string][]trieHit, targets map[string][]strandQuery) map[string][]trieHit {
+	oriented := make(map[string][]trieHit)
+	for seq, hits := range results {
+		for _, t := range targets[seq] {
+			for _, hit := range hits {
+				hit.Strand = t.Strand
+				hit.Matched = seq
+				oriented[t.Seq] = append(oriented[t.Seq], hit)
+			}
+		}
+	}
+	for _, hits := range oriented {
+		sort.SliceStable(hits, func(i, j int) bool {
+			if hits[i].Pos != hits[j].Pos {
+				return hits[i].Pos < hits[j].Pos
+			}
+			return hits[i].Strand < hits[j].Strand
+		})
+	}
+	return oriented
+}
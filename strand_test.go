@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReverseComplement(t *testing.T) {
+	tests := map[string]string{
+		"ACGT":     "ACGT",
+		"AACG":     "CGTT",
+		"acgtN":    "Nacgt",
+		"RYKMBVDH": "DHBVKMRY",
+		"SWN":      "NWS",
+	}
+	for seq, expected := range tests {
+		if got := reverseComplement(seq); got != expected {
+			t.Errorf("reverseComplement(%q): got %q, expected %q", seq, got, expected)
+		}
+		if got := reverseComplement(reverseComplement(seq)); got != seq {
+			t.Errorf("reverseComplement is not an involution on %q: got %q", seq, got)
+		}
+	}
+}
+
+func TestStrandQueries(t *testing.T) {
+	tests := []struct {
+		query, strand string
+		expected      []strandQuery
+	}{
+		{"AAC", strandForward, []strandQuery{{"AAC", '+'}}},
+		{"AAC", strandReverse, []strandQuery{{"GTT", '-'}}},
+		{"AAC", strandBoth, []strandQuery{{"AAC", '+'}, {"GTT", '-'}}},
+		// A palindrome is searched once, on the forward strand.
+		{"GAATTC", strandBoth, []strandQuery{{"GAATTC", '+'}}},
+	}
+	for _, tt := range tests {
+		if got := strandQueries(tt.query, tt.strand); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("strandQueries(%q, %q): got %v, expected %v", tt.query, tt.strand, got, tt.expected)
+		}
+	}
+}
+
+func TestStrandTrieSearch(t *testing.T) {
+	// "AAC" occurs forward at 0 and reverse complemented ("GTT") at 5; the
+	// palindrome "GAATTC" is reported once.
+	text := "AACGAATTCGTT"
+	trie := NewTrie()
+	targets, err := strandTrie(trie, []string{"AAC", "GAATTC"}, strandBoth, defaultMaxExpansions)
+	if err != nil {
+		t.Fatalf("strandTrie: %v", err)
+	}
+	hits := orientTrieHits(trieHitsOf(searchTrie(text, trie)), targets)
+	expected := map[string][]trieHit{
+		"AAC":    {{Pos: 0, Strand: '+', Matched: "AAC"}, {Pos: 9, Strand: '-', Matched: "GTT"}},
+		"GAATTC": {{Pos: 3, Strand: '+', Matched: "GAATTC"}},
+	}
+	if !reflect.DeepEqual(hits, expected) {
+		t.Errorf("Oriented hits: got %v, expected %v", hits, expected)
+	}
+}
+
+func TestStrandTriePalindromicSites(t *testing.T) {
+	// "AN" and its reverse complement "NT" both match every "AT", which is
+	// reported once, on the forward strand; "TT" matches "NT" only.
+	text := "ATCCATTAT"
+	trie := NewTrie()
+	targets, err := strandTrie(trie, []string{"AN"}, strandBoth, defaultMaxExpansions)
+	if err != nil {
+		t.Fatalf("strandTrie: %v", err)
+	}
+	hits := orientTrieHits(trieHitsOf(searchTrie(text, trie)), targets)
+	expected := map[string][]trieHit{
+		"AN": {
+			{Pos: 0, Strand: '+', Matched: "AT"},
+			{Pos: 4, Strand: '+', Matched: "AT"},
+			{Pos: 5, Strand: '-', Matched: "TT"},
+			{Pos: 7, Strand: '+', Matched: "AT"},
+		},
+	}
+	if !reflect.DeepEqual(hits, expected) {
+		t.Errorf("Oriented hits: got %v, expected %v", hits, expected)
+	}
+}
+
+// trieHitsOf converts searchTrie positions to bare trieHits.
+func trieHitsOf(results map[string][]int) map[string][]trieHit {
+	hits := make(map[string][]trieHit)
+	for pat, positions := range results {
+		for _, pos := range positions {
+			hits[pat] = append(hits[pat], trieHit{Pos: pos})
+		}
+	}
+	return hits
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// scanGenome streams a genome in any format parseGenome accepts, without
+// holding it in memory. onRecord is called as each record starts, and onBases
+// receives the text in successive chunks (bases and '$' separators), so
+// positions agree with the text parseGenome would build. Only FASTA headers and
+// single FASTQ records are buffered; sequence lines of any length are streamed.
+func scanGenome(br *bufio.Reader, qf qualityFilter, onRecord func(index int, name string), onBases func(chunk []byte)) error {
+	s := &genomeScanner{qf: qf, onRecord: onRecord, onBases: onBases}
+	for {
+		frag, err := br.ReadSlice('\n')
+		lineEnd := len(frag) > 0 && frag[len(frag)-1] == '\n'
+		if lineEnd {
+			frag = frag[:len(frag)-1]
+		}
+		for _, b := range frag {
+			s.scanByte(b)
+		}
+		if lineEnd || err == io.EOF {
+			if err := s.endLine(); err != nil {
+				return err
+			}
+		}
+		s.flush()
+		switch err {
+		case nil, bufio.ErrBufferFull:
+		case io.EOF:
+			if s.fastqLine != 0 {
+				return fmt.Errorf("fastq: truncated record after %d complete reads", s.reads)
+			}
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// genomeScanner is the line state machine behind scanGenome.
+type genomeScanner struct {
+	qf       qualityFilter
+	onRecord func(index int, name string)
+	onBases  func(chunk []byte)
+
+	format  byte // 0 until the first nonempty line, then '>', '@' or 'p' (plain)
+	records int  // records started so far
+	out     []byte
+
+	// Current line: kind is 0 before its first non-space byte, then '>' for
+	// a FASTA header, 'q' for a FASTQ line (both buffered in line), ';' for
+	// an ignored line or 's' for streamed sequence. Whitespace inside a
+	// sequence line is held in pending until a base follows it, so lines are
+	// trimmed like strings.TrimSpace.
+	kind    byte
+	line    []byte
+	pending []byte
+
+	fastq     [4][]byte
+	fastqLine int
+	reads     int
+}
+
+func isSpaceByte(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\v' || b == '\f'
+}
+
+func (s *genomeScanner) scanByte(b byte) {
+	if s.kind == 0 {
+		if isSpaceByte(b) {
+			return
+		}
+		if s.format == 0 {
+			switch b {
+			case '>', '@':
+				s.format = b
+			default:
+				s.format = 'p'
+			}
+		}
+		switch {
+		case s.format == '@':
+			s.kind = 'q'
+		case s.format == 'p':
+			s.kind = 's'
+			s.startRecord("")
+		case b == '>':
+			s.kind = '>'
+		case b == ';' || s.records == 0:
+			// Comments, and sequence before the first header, are skipped.
+			s.kind = ';'
+		default:
+			s.kind = 's'
+		}
+	}
+	switch s.kind {
+	case '>', 'q':
+		s.line = append(s.line, b)
+	case 's':
+		if isSpaceByte(b) {
+			s.pending = append(s.pending, b)
+			return
+		}
+		s.out = append(s.out, s.pending...)
+		s.pending = s.pending[:0]
+		if 'a' <= b && b <= 'z' {
+			b -= 'a' - 'A'
+		}
+		s.out = append(s.out, b)
+	}
+}
+
+// endLine finishes the current line: a FASTA header starts a record, and every
+// fourth FASTQ line completes a read.
+func (s *genomeScanner) endLine() error {
+	switch s.kind {
+	case '>':
+		s.startRecord(headerName(string(s.line[1:])))
+	case 'q':
+		s.fastq[s.fastqLine] = append(s.fastq[s.fastqLine][:0], bytes.TrimSpace(s.line)...)
+		s.fastqLine++
+		if s.fastqLine == 4 {
+			s.fastqLine = 0
+			if err := s.endRead(); err != nil {
+				return err
+			}
+		}
+	}
+	s.kind = 0
+	s.line = s.line[:0]
+	s.pending = s.pending[:0]
+	return nil
+}
+
+// endRead validates a complete FASTQ record and, if the quality filter keeps
+// it, emits it as a record.
+func (s *genomeScanner) endRead() error {
+	s.reads++
+	header, seq, sep, qual := s.fastq[0], s.fastq[1], s.fastq[2], s.fastq[3]
+	if header[0] != '@' {
+		return fmt.Errorf("fastq: record %d: header %q does not start with '@'", s.reads, header)
+	}
+	if sep[0] != '+' {
+		return fmt.Errorf("fastq: record %d: expected '+' separator line, got %q", s.reads, sep)
+	}
+	if len(seq) != len(qual) {
+		return fmt.Errorf("fastq: record %d: sequence length %d does not match quality length %d", s.reads, len(seq), len(qual))
+	}
+	trimmed, ok := s.qf.apply(string(bytes.ToUpper(seq)), string(qual))
+	if !ok {
+		return nil
+	}
+	s.startRecord(headerName(string(header[1:])))
+	s.out = append(s.out, trimmed...)
+	return nil
+}
+
+// startRecord emits the separator before every record but the first and
+// announces the record once the text before it has been delivered.
+func (s *genomeScanner) startRecord(name string) {
+	if s.records > 0 {
+		s.out = append(s.out, '$')
+	}
+	s.flush()
+	s.onRecord(s.records, name)
+	s.records++
+}
+
+func (s *genomeScanner) flush() {
+	if len(s.out) > 0 {
+		s.onBases(s.out)
+		s.out = s.out[:0]
+	}
+}
+
+// streamTrieSearch scans a genome file, or standard input if it is named "-",
+// with the trie without loading it, annotating every hit with the record it
+// falls in.
+func streamTrieSearch(fileName string, qf qualityFilter, root *TrieNode) (map[string][]trieHit, error) {
+	r, release, err := openInput(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	results := make(map[string][]trieHit)
+	m := newTrieMatcher(root)
+	var record trieHit // the current record; Pos holds its start
+	onRecord := func(index int, name string) {
+		record = trieHit{Pos: m.pos, Record: index, Name: name}
+	}
+	onBases := func(chunk []byte) {
+		m.feed(chunk, func(pattern string, start int) {
+			results[pattern] = append(results[pattern], trieHit{
+				Pos:    start,
+				Record: record.Record,
+				Name:   record.Name,
+				Offset: start - record.Pos,
+			})
+		})
+	}
+	if err := scanGenome(bufio.NewReaderSize(r, 1<<16), qf, onRecord, onBases); err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return results, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanGenomeMatchesParseGenome(t *testing.T) {
+	// A tiny reader buffer splits lines, headers and FASTQ records across
+	// fragments; the streamed text and records must still match parseGenome.
+	qf := qualityFilter{TrimQual: 20}
+	inputs := []string{
+		">chr1 first chromosome\n  ACGTacgtNNNNacgtACGTAC  \n;comment\n  TT GG\n\n>chr2\nGGCC\n>empty\n>chr3 a much longer description line\nacgtacgtacgtacgtacgtacgt\r\n",
+		"ACGT\n\n  TGCA \nacgtacgtacgtacgtacgt\n",
+		"@r1 desc\nACGTACGTAC\n+\nIIIIIIII##\n\n@r2\nacgtttt\n+\n!!!!!!!\n@r3\nGGGGCCCCAAAATTTT\n+r3\nIIIIIIIIIIIIIIII\n",
+	}
+	for _, data := range inputs {
+		g, err := parseGenome([]byte(data), qf)
+		if err != nil {
+			t.Fatalf("parseGenome: %v", err)
+		}
+		var text strings.Builder
+		var records []Record
+		onRecord := func(index int, name string) {
+			if index != len(records) {
+				t.Fatalf("Record index %d, expected %d", index, len(records))
+			}
+			records = append(records, Record{Name: name, Start: text.Len()})
+		}
+		onBases := func(chunk []byte) { text.Write(chunk) }
+		if err := scanGenome(bufio.NewReaderSize(strings.NewReader(data), 16), qf, onRecord, onBases); err != nil {
+			t.Fatalf("scanGenome: %v", err)
+		}
+		for i := range records {
+			end := text.Len()
+			if i+1 < len(records) {
+				end = records[i+1].Start - 1
+			}
+			records[i].Len = end - records[i].Start
+		}
+		if text.String() != g.Text {
+			t.Errorf("Streamed text: got %q, expected %q", text.String(), g.Text)
+		}
+		if !reflect.DeepEqual(records, g.Records) {
+			t.Errorf("Streamed records: got %v, expected %v", records, g.Records)
+		}
+	}
+
+	// Truncated FASTQ input is rejected like parseGenome does.
+	err := scanGenome(bufio.NewReaderSize(strings.NewReader("@r1\nACGT\n+\n"), 16), qualityFilter{}, func(int, string) {}, func([]byte) {})
+	if err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("Expected a truncated record error, got %v", err)
+	}
+}
+
+func TestStreamTrieSearch(t *testing.T) {
+	// Hits streamed from a gzip-compressed FASTA file agree with searchTrie
+	// over the parsed genome, and carry record-relative offsets.
+	data := ">chrA\nACGTAC\nGTAC\n>chrB\nTACGTT\n"
+	path := filepath.Join(t.TempDir(), "genome.fa.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	zw.Write([]byte(data))
+	zw.Close()
+	f.Close()
+
+	newTrie := func() *TrieNode {
+		trie := NewTrie()
+		for _, p := range []string{"ACGT", "TAC", "GT"} {
+			trie.Insert(p)
+		}
+		return trie
+	}
+	results, err := streamTrieSearch(path, qualityFilter{}, newTrie())
+	if err != nil {
+		t.Fatalf("streamTrieSearch: %v", err)
+	}
+	g, _ := parseGenome([]byte(data), qualityFilter{})
+	expected := searchTrie(g.Text, newTrie())
+	if len(results) != len(expected) {
+		t.Fatalf("Patterns found: got %d, expected %d", len(results), len(expected))
+	}
+	for pat, positions := range expected {
+		hits := results[pat]
+		if len(hits) != len(positions) {
+			t.Fatalf("Pattern %q: got %v, expected positions %v", pat, hits, positions)
+		}
+		for i, hit := range hits {
+			rec := g.Records[g.recordAt(positions[i])]
+			want := trieHit{Pos: positions[i], Record: g.recordAt(positions[i]), Name: rec.Name, Offset: positions[i] - rec.Start}
+			if hit != want {
+				t.Errorf("Pattern %q hit %d: got %+v, expected %+v", pat, i, hit, want)
+			}
+		}
+	}
+}
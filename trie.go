@@ -1,10 +1,17 @@
 package main
 
-// TrieNode represents a node in the trie.
+// TrieNode represents a node in the trie. Once all patterns are inserted, Build
+// adds the Aho–Corasick failure and output links used by searchTrie.
 type TrieNode struct {
 	children map[rune]*TrieNode
 	isEnd    bool
 	pattern  string
+	// fail points to the node of the longest proper suffix of this node's
+	// string that is also in the trie.
+	fail *TrieNode
+	// output points to the nearest node along the fail chain that ends a
+	// pattern, so nested patterns are reported without walking every link.
+	output *TrieNode
 }
 
 // NewTrie creates a new empty trie node.
@@ -28,24 +35,98 @@ func (node *TrieNode) Insert(pattern string) {
 	current.pattern = pattern
 }
 
-// searchTrie scans the text and returns a map where each key is a pattern found
-// and the value is a slice of starting positions where that pattern occurs.
-func searchTrie(text string, root *TrieNode) map[string][]int {
-	results := make(map[string][]int)
-	// For each position in the text, try to match a pattern.
-	for i := 0; i < len(text); i++ {
-		current := root
-		for j := i; j < len(text); j++ {
-			ch := rune(text[j])
-			next, exists := current.children[ch]
-			if !exists {
-				break
+// Build computes the failure and output links of every node below the root in
+// breadth-first order. It must be called again after further inserts.
+func (node *TrieNode) Build() {
+	node.fail, node.output = nil, nil
+	queue := []*TrieNode{node}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for ch, child := range current.children {
+			// The child's fail link extends the longest suffix of the
+			// parent's string that can be followed by ch.
+			fail := current.fail
+			for fail != nil && fail.children[ch] == nil {
+				fail = fail.fail
+			}
+			if fail == nil {
+				child.fail = node
+			} else {
+				child.fail = fail.children[ch]
 			}
-			current = next
-			if current.isEnd {
-				results[current.pattern] = append(results[current.pattern], i)
+			if child.fail.isEnd {
+				child.output = child.fail
+			} else {
+				child.output = child.fail.output
+			}
+			queue = append(queue, child)
+		}
+	}
+}
+
+// step advances the automaton from current on ch, following failure links
+// until a transition exists or the root is reached.
+func (node *TrieNode) step(current *TrieNode, ch rune) *TrieNode {
+	for current != node && current.children[ch] == nil {
+		current = current.fail
+	}
+	if next := current.children[ch]; next != nil {
+		return next
+	}
+	return node
+}
+
+// trieMatcher runs the automaton over text delivered in chunks, carrying its
+// state and the global position across chunk boundaries.
+type trieMatcher struct {
+	root    *TrieNode
+	current *TrieNode
+	pos     int // global position of the next byte
+}
+
+// newTrieMatcher builds the automaton links of root and starts a scan at
+// position 0.
+func newTrieMatcher(root *TrieNode) *trieMatcher {
+	root.Build()
+	return &trieMatcher{root: root, current: root}
+}
+
+// feed scans the next chunk of text, calling emit with the pattern and global
+// start position of every occurrence ending in it.
+func (m *trieMatcher) feed(chunk []byte, emit func(pattern string, start int)) {
+	for _, b := range chunk {
+		m.current = m.root.step(m.current, rune(b))
+		// Report every pattern ending here: the node itself and its output chain.
+		for match := m.current; match != nil; match = match.output {
+			if match.isEnd {
+				emit(match.pattern, m.pos+1-len(match.pattern))
 			}
 		}
+		m.pos++
 	}
+}
+
+// trieHit is one occurrence of a pattern found by a streaming trie scan.
+type trieHit struct {
+	Pos    int    // global position in the concatenated genome
+	Record int    // index of the record containing the hit
+	Name   string // record name, empty for plain line input
+	Offset int    // position within the record
+	Strand byte   // '+' or '-' once oriented by orientTrieHits
+	// Matched is the forward-strand text of the hit, which differs from the
+	// pattern for reverse and degenerate patterns.
+	Matched string
+}
+
+// searchTrie scans the text once with the Aho–Corasick automaton and returns a
+// map where each key is a pattern found and the value is a slice of starting
+// positions where that pattern occurs, including overlapping and nested
+// occurrences.
+func searchTrie(text string, root *TrieNode) map[string][]int {
+	results := make(map[string][]int)
+	newTrieMatcher(root).feed([]byte(text), func(pattern string, start int) {
+		results[pattern] = append(results[pattern], start)
+	})
 	return results
 }
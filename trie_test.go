@@ -32,3 +32,26 @@ func TestTrieSearch(t *testing.T) {
 		t.Errorf("Trie search results mismatch. Expected %v, got %v", expected, results)
 	}
 }
+
+func TestTrieSearchOverlappingAndNested(t *testing.T) {
+	text := "AAACAACA"
+	patterns := []string{"A", "AA", "AAA", "CA", "ACA", "AACA", "G"}
+	trie := NewTrie()
+	for _, pat := range patterns {
+		trie.Insert(pat)
+	}
+	results := searchTrie(text, trie)
+
+	// Compare against a naive scan of every pattern at every position.
+	expected := make(map[string][]int)
+	for _, pat := range patterns {
+		for i := 0; i+len(pat) <= len(text); i++ {
+			if text[i:i+len(pat)] == pat {
+				expected[pat] = append(expected[pat], i)
+			}
+		}
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Trie search results mismatch. Expected %v, got %v", expected, results)
+	}
+}